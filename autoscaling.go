@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ServiceAutoScaling is the Application Auto Scaling configuration and recent activity of a
+// service's desired count.
+type ServiceAutoScaling struct {
+	Target           *applicationautoscaling.ScalableTarget
+	Policies         []*applicationautoscaling.ScalingPolicy
+	ScheduledActions []*applicationautoscaling.ScheduledAction
+	Activities       []*applicationautoscaling.ScalingActivity
+}
+
+// ServiceResourceID returns the Application Auto Scaling resource ID of a service.
+func ServiceResourceID(service *ecs.Service) string {
+	return fmt.Sprintf("service/%v/%v", ecsq.ParseARN(aws.StringValue(service.ClusterArn)).Name, aws.StringValue(service.ServiceName))
+}
+
+// GetServiceAutoScaling describes the auto scaling of the service's desired count. It returns nil
+// if the service is not a scalable target.
+func GetServiceAutoScaling(ctx context.Context, svc *applicationautoscaling.ApplicationAutoScaling, service *ecs.Service) (*ServiceAutoScaling, error) {
+	namespace := aws.String(applicationautoscaling.ServiceNamespaceEcs)
+	dimension := aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount)
+	resourceID := aws.String(ServiceResourceID(service))
+	targets, err := svc.DescribeScalableTargetsWithContext(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  namespace,
+		ScalableDimension: dimension,
+		ResourceIds:       []*string{resourceID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(targets.ScalableTargets) == 0 {
+		return nil, nil
+	}
+	scaling := &ServiceAutoScaling{Target: targets.ScalableTargets[0]}
+	err = svc.DescribeScalingPoliciesPagesWithContext(ctx, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  namespace,
+		ScalableDimension: dimension,
+		ResourceId:        resourceID,
+	}, func(page *applicationautoscaling.DescribeScalingPoliciesOutput, lastPage bool) bool {
+		scaling.Policies = append(scaling.Policies, page.ScalingPolicies...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = svc.DescribeScheduledActionsPagesWithContext(ctx, &applicationautoscaling.DescribeScheduledActionsInput{
+		ServiceNamespace:  namespace,
+		ScalableDimension: dimension,
+		ResourceId:        resourceID,
+	}, func(page *applicationautoscaling.DescribeScheduledActionsOutput, lastPage bool) bool {
+		scaling.ScheduledActions = append(scaling.ScheduledActions, page.ScheduledActions...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only the first page of activities is fetched, which holds the most recent ones.
+	activities, err := svc.DescribeScalingActivitiesWithContext(ctx, &applicationautoscaling.DescribeScalingActivitiesInput{
+		ServiceNamespace:  namespace,
+		ScalableDimension: dimension,
+		ResourceId:        resourceID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	scaling.Activities = activities.ScalingActivities
+	return scaling, nil
+}
+
+// ScalingActivityEvents converts scaling activities to service events, so that they can be shown
+// in the same timeline.
+func ScalingActivityEvents(activities []*applicationautoscaling.ScalingActivity) []*ecs.ServiceEvent {
+	events := []*ecs.ServiceEvent{}
+	for _, a := range activities {
+		message := fmt.Sprintf("(auto scaling) %v: %v", aws.StringValue(a.StatusCode), strings.TrimSuffix(aws.StringValue(a.Description), "."))
+		if cause := aws.StringValue(a.Cause); cause != "" {
+			message += ". Cause: " + cause
+		}
+		if status := aws.StringValue(a.StatusMessage); status != "" {
+			message += ". " + status
+		}
+		events = append(events, &ecs.ServiceEvent{
+			Id:        a.ActivityId,
+			CreatedAt: a.StartTime,
+			Message:   aws.String(message),
+		})
+	}
+	return events
+}
+
+// FormatScalingPolicy describes what a scaling policy tracks and how it scales.
+func FormatScalingPolicy(p *applicationautoscaling.ScalingPolicy) (metric, scaling string) {
+	if c := p.TargetTrackingScalingPolicyConfiguration; c != nil {
+		switch {
+		case c.PredefinedMetricSpecification != nil:
+			metric = aws.StringValue(c.PredefinedMetricSpecification.PredefinedMetricType)
+		case c.CustomizedMetricSpecification != nil:
+			m := c.CustomizedMetricSpecification
+			metric = fmt.Sprintf("%v/%v (%v)", aws.StringValue(m.Namespace), aws.StringValue(m.MetricName), aws.StringValue(m.Statistic))
+		}
+		scaling = "target " + strconv.FormatFloat(aws.Float64Value(c.TargetValue), 'f', -1, 64)
+		if aws.BoolValue(c.DisableScaleIn) {
+			scaling += ", scale-in disabled"
+		}
+		return metric, scaling
+	}
+	alarms := []string{}
+	for _, a := range p.Alarms {
+		alarms = append(alarms, aws.StringValue(a.AlarmName))
+	}
+	metric = strings.Join(alarms, ", ")
+	if c := p.StepScalingPolicyConfiguration; c != nil {
+		steps := []string{}
+		for _, step := range c.StepAdjustments {
+			steps = append(steps, fmt.Sprintf("[%v, %v): %+d",
+				formatBound(step.MetricIntervalLowerBound, "-inf"),
+				formatBound(step.MetricIntervalUpperBound, "+inf"),
+				aws.Int64Value(step.ScalingAdjustment)))
+		}
+		scaling = strings.Join(steps, "\n")
+		if t := aws.StringValue(c.AdjustmentType); t != "" {
+			scaling = t + "\n" + scaling
+		}
+	}
+	return metric, scaling
+}
+
+func formatBound(b *float64, unbounded string) string {
+	if b == nil {
+		return unbounded
+	}
+	return strconv.FormatFloat(*b, 'f', -1, 64)
+}
+
+// RenderServiceAutoScaling writes the scalable target, policies, scheduled actions and recent
+// scaling activities as tables.
+func RenderServiceAutoScaling(w io.Writer, scaling *ServiceAutoScaling) {
+	if scaling == nil {
+		return
+	}
+	fmt.Fprintln(w, "Auto Scaling")
+	table := NewTable(w)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Append([]string{"Min Capacity", strconv.FormatInt(aws.Int64Value(scaling.Target.MinCapacity), 10)})
+	table.Append([]string{"Max Capacity", strconv.FormatInt(aws.Int64Value(scaling.Target.MaxCapacity), 10)})
+	if s := scaling.Target.SuspendedState; s != nil {
+		suspended := []string{}
+		if aws.BoolValue(s.DynamicScalingInSuspended) {
+			suspended = append(suspended, "scale in")
+		}
+		if aws.BoolValue(s.DynamicScalingOutSuspended) {
+			suspended = append(suspended, "scale out")
+		}
+		if aws.BoolValue(s.ScheduledScalingSuspended) {
+			suspended = append(suspended, "scheduled")
+		}
+		if len(suspended) > 0 {
+			table.Append([]string{"Suspended", strings.Join(suspended, ", ")})
+		}
+	}
+	table.Render()
+
+	if len(scaling.Policies) > 0 {
+		fmt.Fprintln(w, "Scaling Policies")
+		header := []string{"Name", "Type", "Metric", "Scaling"}
+		rows := [][]string{}
+		for _, p := range scaling.Policies {
+			metric, how := FormatScalingPolicy(p)
+			rows = append(rows, []string{aws.StringValue(p.PolicyName), aws.StringValue(p.PolicyType), metric, how})
+		}
+		table = NewTable(w)
+		table.SetHeader(header)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+		table.Render()
+	}
+
+	if len(scaling.ScheduledActions) > 0 {
+		fmt.Fprintln(w, "Scheduled Actions")
+		header := []string{"Name", "Schedule", "Min", "Max"}
+		rows := [][]string{}
+		for _, a := range scaling.ScheduledActions {
+			schedule := aws.StringValue(a.Schedule)
+			if tz := aws.StringValue(a.Timezone); tz != "" {
+				schedule += " " + tz
+			}
+			min, max := "", ""
+			if action := a.ScalableTargetAction; action != nil {
+				if action.MinCapacity != nil {
+					min = strconv.FormatInt(*action.MinCapacity, 10)
+				}
+				if action.MaxCapacity != nil {
+					max = strconv.FormatInt(*action.MaxCapacity, 10)
+				}
+			}
+			rows = append(rows, []string{aws.StringValue(a.ScheduledActionName), schedule, min, max})
+		}
+		table = NewTable(w)
+		table.SetHeader(header)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+		table.Render()
+	}
+
+	if len(scaling.Activities) > 0 {
+		fmt.Fprintln(w, "Scaling Activities")
+		header := []string{"Time", "Status", "Description", "Cause"}
+		rows := [][]string{}
+		for _, a := range scaling.Activities {
+			rows = append(rows, []string{
+				aws.TimeValue(a.StartTime).Format(time.RFC3339),
+				aws.StringValue(a.StatusCode),
+				aws.StringValue(a.Description),
+				aws.StringValue(a.Cause),
+			})
+		}
+		table = NewTable(w)
+		table.SetHeader(header)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+		table.Render()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestServiceResourceID(t *testing.T) {
+	service := &ecs.Service{
+		ClusterArn:  aws.String("arn:aws:ecs:us-west-2:123456789012:cluster/ecs-prod"),
+		ServiceName: aws.String("applepicker"),
+	}
+	assertTrue(t, ServiceResourceID(service) == "service/ecs-prod/applepicker")
+}
+
+func TestScalingActivityEvents(t *testing.T) {
+	now := time.Now()
+	service := []*ecs.ServiceEvent{
+		{CreatedAt: aws.Time(now.Add(-time.Minute)), Message: aws.String("(service applepicker) has reached a steady state.")},
+	}
+	activities := ScalingActivityEvents([]*applicationautoscaling.ScalingActivity{{
+		ActivityId:  aws.String("a1"),
+		StartTime:   aws.Time(now.Add(-2 * time.Minute)),
+		StatusCode:  aws.String("Successful"),
+		Description: aws.String("Setting desired count to 4."),
+		Cause:       aws.String("monitor alarm high-cpu in state ALARM triggered policy cpu75"),
+	}})
+	events := append(service, activities...)
+	MustParseSort("time", ServiceEventSortKeys).Sort(events)
+	assertTrue(t, aws.StringValue(events[0].Id) == "a1")
+	assertTrue(t, aws.StringValue(events[0].Message) == "(auto scaling) Successful: Setting desired count to 4. Cause: monitor alarm high-cpu in state ALARM triggered policy cpu75")
+}
+
+func TestFormatScalingPolicy(t *testing.T) {
+	metric, scaling := FormatScalingPolicy(&applicationautoscaling.ScalingPolicy{
+		PolicyType: aws.String("TargetTrackingScaling"),
+		TargetTrackingScalingPolicyConfiguration: &applicationautoscaling.TargetTrackingScalingPolicyConfiguration{
+			PredefinedMetricSpecification: &applicationautoscaling.PredefinedMetricSpecification{
+				PredefinedMetricType: aws.String("ECSServiceAverageCPUUtilization"),
+			},
+			TargetValue: aws.Float64(75),
+		},
+	})
+	assertTrue(t, metric == "ECSServiceAverageCPUUtilization")
+	assertTrue(t, scaling == "target 75")
+
+	metric, scaling = FormatScalingPolicy(&applicationautoscaling.ScalingPolicy{
+		PolicyType: aws.String("StepScaling"),
+		Alarms:     []*applicationautoscaling.Alarm{{AlarmName: aws.String("queue-depth")}},
+		StepScalingPolicyConfiguration: &applicationautoscaling.StepScalingPolicyConfiguration{
+			AdjustmentType: aws.String("ChangeInCapacity"),
+			StepAdjustments: []*applicationautoscaling.StepAdjustment{
+				{MetricIntervalLowerBound: aws.Float64(0), MetricIntervalUpperBound: aws.Float64(100), ScalingAdjustment: aws.Int64(1)},
+				{MetricIntervalLowerBound: aws.Float64(100), ScalingAdjustment: aws.Int64(3)},
+			},
+		},
+	})
+	assertTrue(t, metric == "queue-depth")
+	assertTrue(t, scaling == "ChangeInCapacity\n[0, 100): +1\n[100, +inf): +3")
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTLs are the default lifetimes of cached responses, by resource type.
+var DefaultCacheTTLs = map[string]time.Duration{
+	"clusters":                 time.Minute,
+	"services":                 time.Minute,
+	"tasks":                    30 * time.Second,
+	"task-definitions":         time.Minute,
+	"task-definition-revision": 24 * time.Hour,
+	"container-instances":      5 * time.Minute,
+	"instances":                10 * time.Minute,
+	"other":                    time.Minute,
+}
+
+// ErrNotCached is returned in offline mode when a response is not in the cache.
+var ErrNotCached = errors.New("response not in cache, run the command again without --offline")
+
+// ResponseCache is an http.RoundTripper that stores the responses of List and Describe API calls on
+// disk, keyed by credentials, endpoint, region and cluster, and serves them back until they expire.
+type ResponseCache struct {
+	// Dir is the root directory of the cache.
+	Dir string
+	// Identity names the credentials the requests are made with, as returned by CacheIdentity, so
+	// that profiles for different accounts do not share responses. It is hashed before it is used
+	// in paths.
+	Identity string
+	// TTLs maps resource types to how long their responses are served from the cache.
+	TTLs map[string]time.Duration
+	// Refresh skips reading from the cache, but still stores fresh responses.
+	Refresh bool
+	// Offline serves every response from the cache regardless of age, and never makes requests.
+	Offline bool
+	// Next is the transport used to make requests that are not served from the cache.
+	Next http.RoundTripper
+
+	mu     sync.Mutex
+	oldest time.Time
+}
+
+type cachedResponse struct {
+	StoredAt    time.Time `json:"storedAt"`
+	StatusCode  int       `json:"statusCode"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+}
+
+// DefaultCacheDir returns the cache directory, which can be overridden with ECSQ_CACHE_DIR.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("ECSQ_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ecsq")
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *ResponseCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	call := identifyAPICall(req, body)
+	if !call.Cacheable() {
+		if c.Offline {
+			return nil, fmt.Errorf("%v %v: %w", call.Service, call.Operation, ErrNotCached)
+		}
+		return c.Next.RoundTrip(req)
+	}
+	path := c.path(req, call, body)
+	if c.Offline || !c.Refresh {
+		cached, err := readCachedResponse(path)
+		if err == nil && (c.Offline || time.Since(cached.StoredAt) < c.ttl(call)) {
+			c.served(cached.StoredAt)
+			return cached.response(req), nil
+		}
+		if c.Offline {
+			return nil, fmt.Errorf("%v %v: %w", call.Service, call.Operation, ErrNotCached)
+		}
+	}
+	resp, err := c.Next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	// The cache is best effort, a failure to write it should not fail the command.
+	_ = writeCachedResponse(path, &cachedResponse{
+		StoredAt:    time.Now(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        respBody,
+	})
+	return resp, nil
+}
+
+// OldestEntry returns the time the oldest response served from the cache was stored, or the zero
+// time if no responses were served from the cache.
+func (c *ResponseCache) OldestEntry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.oldest
+}
+
+func (c *ResponseCache) served(storedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oldest.IsZero() || storedAt.Before(c.oldest) {
+		c.oldest = storedAt
+	}
+}
+
+func (c *ResponseCache) ttl(call apiCall) time.Duration {
+	if ttl, ok := c.TTLs[call.Resource()]; ok {
+		return ttl
+	}
+	return DefaultCacheTTLs[call.Resource()]
+}
+
+// path returns where the response to a request is cached. The endpoint host is part of the hash,
+// so responses from LocalStack and AWS are kept apart.
+func (c *ResponseCache) path(req *http.Request, call apiCall, body []byte) string {
+	identity := c.Identity
+	if identity == "" {
+		identity = "_"
+	}
+	cluster := call.Cluster
+	if cluster == "" {
+		cluster = "_"
+	}
+	hash := sha256.New()
+	hash.Write([]byte(req.URL.Host))
+	hash.Write([]byte(call.Operation))
+	hash.Write(body)
+	name := call.Operation + "-" + hex.EncodeToString(hash.Sum(nil))[:16] + ".json"
+	return filepath.Join(c.Dir, identityDir(identity), call.Region, url.PathEscape(cluster), name)
+}
+
+// identityDir returns the directory the responses of an identity are cached in. The identity is
+// hashed so access key IDs do not appear in file names.
+func identityDir(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func readCachedResponse(path string) (*cachedResponse, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(b, cached); err != nil {
+		return nil, err
+	}
+	return cached, nil
+}
+
+func writeCachedResponse(path string, cached *cachedResponse) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func (r *cachedResponse) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", r.ContentType)
+	return &http.Response{
+		Status:        http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readRequestBody reads the body of the request and replaces it so the request can still be sent.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// apiCall identifies an AWS API call from its raw HTTP request.
+type apiCall struct {
+	Service   string
+	Operation string
+	Region    string
+	Cluster   string
+	// TaskDefinition is set for DescribeTaskDefinition calls.
+	TaskDefinition string
+}
+
+// identifyAPICall works out the service, operation and cluster of a request made with the JSON
+// protocol (ECS) or the query protocol (EC2, STS).
+func identifyAPICall(req *http.Request, body []byte) apiCall {
+	call := apiCall{}
+	host := strings.Split(req.URL.Hostname(), ".")
+	if len(host) > 0 {
+		call.Service = host[0]
+	}
+	if len(host) > 1 {
+		call.Region = host[1]
+	}
+	// Custom endpoints, such as LocalStack, do not name the service and region, but the credential
+	// scope the request is signed with does.
+	if _, credential, ok := strings.Cut(req.Header.Get("Authorization"), "Credential="); ok {
+		scope := strings.Split(strings.Split(credential, ",")[0], "/")
+		if len(scope) == 5 {
+			call.Region, call.Service = scope[2], scope[3]
+		}
+	}
+	if target := req.Header.Get("X-Amz-Target"); target != "" {
+		call.Operation = target[strings.LastIndex(target, ".")+1:]
+		var params struct {
+			Cluster        string `json:"cluster"`
+			TaskDefinition string `json:"taskDefinition"`
+		}
+		_ = json.Unmarshal(body, &params)
+		call.Cluster = params.Cluster
+		call.TaskDefinition = params.TaskDefinition
+	} else if values, err := url.ParseQuery(string(body)); err == nil {
+		call.Operation = values.Get("Action")
+	}
+	return call
+}
+
+// Cacheable returns whether the call only reads List or Describe data.
+func (c apiCall) Cacheable() bool {
+	return strings.HasPrefix(c.Operation, "List") || strings.HasPrefix(c.Operation, "Describe")
+}
+
+// Resource returns the resource type of the call, used to pick a cache TTL.
+func (c apiCall) Resource() string {
+	op := c.Operation
+	switch {
+	case op == "DescribeTaskDefinition" && strings.Contains(taskDefinitionRevision(c.TaskDefinition), ":"):
+		return "task-definition-revision"
+	case strings.HasSuffix(op, "TaskDefinition") || strings.HasSuffix(op, "TaskDefinitions"):
+		return "task-definitions"
+	case strings.HasSuffix(op, "ContainerInstances"):
+		return "container-instances"
+	case strings.HasSuffix(op, "Clusters"):
+		return "clusters"
+	case strings.HasSuffix(op, "Services"):
+		return "services"
+	case strings.HasSuffix(op, "Tasks"):
+		return "tasks"
+	case strings.HasSuffix(op, "Instances"):
+		return "instances"
+	}
+	return "other"
+}
+
+// ParseCacheTTLs parses resource=duration pairs, as given to --cache-ttl.
+func ParseCacheTTLs(pairs map[string]string) (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{}
+	for resource, value := range pairs {
+		if _, ok := DefaultCacheTTLs[resource]; !ok {
+			return nil, fmt.Errorf("unknown cache resource %q", resource)
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache TTL for %v: %v", resource, err)
+		}
+		ttls[resource] = ttl
+	}
+	return ttls, nil
+}
+
+// CacheIdentity returns the name responses made with the current credentials are cached under: the
+// access key when credentials come from the environment, otherwise the profile.
+func CacheIdentity(profile string) string {
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		return "key:" + key
+	}
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	return "profile:" + profile
+}
+
+// FormatCacheAge renders how long ago a cached response was stored.
+func FormatCacheAge(storedAt time.Time) string {
+	return fmt.Sprintf("Showing cached results from %v ago. Use --no-cache to refresh.", time.Since(storedAt).Round(time.Second))
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/olekukonko/tablewriter"
+)
+
+// CapacityTotals sums the resources of a group of container instances.
+type CapacityTotals struct {
+	Group            string `json:"group"`
+	Instances        int    `json:"instances"`
+	RegisteredCPU    int64  `json:"registeredCpu"`
+	RemainingCPU     int64  `json:"remainingCpu"`
+	RegisteredMemory int64  `json:"registeredMemory"`
+	RemainingMemory  int64  `json:"remainingMemory"`
+	// ReservedPorts counts the host ports reserved on the instances, by the agent and by tasks.
+	ReservedPorts int `json:"reservedPorts"`
+}
+
+// PlaceableTask is the largest task that fits on a single container instance.
+type PlaceableTask struct {
+	Instance string `json:"instance"`
+	CPU      int64  `json:"cpu"`
+	Memory   int64  `json:"memory"`
+}
+
+// ServiceReservation is the CPU and memory a service reserves across all of its desired tasks.
+type ServiceReservation struct {
+	Service      string `json:"service"`
+	LaunchType   string `json:"launchType"`
+	DesiredCount int64  `json:"desiredCount"`
+	TaskCPU      int64  `json:"taskCpu"`
+	TaskMemory   int64  `json:"taskMemory"`
+}
+
+// TotalCPU returns the CPU reserved by all desired tasks.
+func (r ServiceReservation) TotalCPU() int64 {
+	return r.TaskCPU * r.DesiredCount
+}
+
+// TotalMemory returns the memory reserved by all desired tasks.
+func (r ServiceReservation) TotalMemory() int64 {
+	return r.TaskMemory * r.DesiredCount
+}
+
+// CapacityReport describes the resources of a cluster and how they are used.
+type CapacityReport struct {
+	Total               CapacityTotals       `json:"total"`
+	ByInstanceType      []CapacityTotals     `json:"byInstanceType"`
+	ByAvailabilityZone  []CapacityTotals     `json:"byAvailabilityZone"`
+	LargestByMemory     *PlaceableTask       `json:"largestByMemory"`
+	LargestByCPU        *PlaceableTask       `json:"largestByCpu"`
+	ServiceReservations []ServiceReservation `json:"serviceReservations"`
+}
+
+// NewCapacityReport adds up the resources of the active container instances, and the resources
+// reserved by services.
+func NewCapacityReport(instances []*ecs.ContainerInstance, services []*ecs.Service, taskDefinitions map[string]*ecs.TaskDefinition) *CapacityReport {
+	report := &CapacityReport{Total: CapacityTotals{Group: "Total"}, ServiceReservations: []ServiceReservation{}}
+	byType := map[string]*CapacityTotals{}
+	byAZ := map[string]*CapacityTotals{}
+	add := func(groups map[string]*CapacityTotals, name string, ci *ecs.ContainerInstance) {
+		if name == "" {
+			name = "unknown"
+		}
+		totals, ok := groups[name]
+		if !ok {
+			totals = &CapacityTotals{Group: name}
+			groups[name] = totals
+		}
+		totals.add(ci)
+	}
+	for _, ci := range instances {
+		if aws.StringValue(ci.Status) != ecs.ContainerInstanceStatusActive {
+			continue
+		}
+		report.Total.add(ci)
+		add(byType, containerInstanceAttribute(ci, "ecs.instance-type"), ci)
+		add(byAZ, containerInstanceAttribute(ci, "ecs.availability-zone"), ci)
+
+		placeable := &PlaceableTask{
+			Instance: containerInstanceName(ci),
+			CPU:      resourceValue(ci.RemainingResources, "CPU"),
+			Memory:   resourceValue(ci.RemainingResources, "MEMORY"),
+		}
+		if report.LargestByMemory == nil || placeable.Memory > report.LargestByMemory.Memory ||
+			(placeable.Memory == report.LargestByMemory.Memory && placeable.CPU > report.LargestByMemory.CPU) {
+			report.LargestByMemory = placeable
+		}
+		if report.LargestByCPU == nil || placeable.CPU > report.LargestByCPU.CPU ||
+			(placeable.CPU == report.LargestByCPU.CPU && placeable.Memory > report.LargestByCPU.Memory) {
+			report.LargestByCPU = placeable
+		}
+	}
+	report.ByInstanceType = sortedTotals(byType)
+	report.ByAvailabilityZone = sortedTotals(byAZ)
+
+	for _, s := range services {
+		cpu, memory := TaskDefinitionReservation(taskDefinitions[aws.StringValue(s.TaskDefinition)])
+		report.ServiceReservations = append(report.ServiceReservations, ServiceReservation{
+			Service:      aws.StringValue(s.ServiceName),
+			LaunchType:   aws.StringValue(s.LaunchType),
+			DesiredCount: aws.Int64Value(s.DesiredCount),
+			TaskCPU:      cpu,
+			TaskMemory:   memory,
+		})
+	}
+	sort.SliceStable(report.ServiceReservations, func(i, j int) bool {
+		a, b := report.ServiceReservations[i], report.ServiceReservations[j]
+		if a.TotalMemory() != b.TotalMemory() {
+			return a.TotalMemory() > b.TotalMemory()
+		}
+		return a.Service < b.Service
+	})
+	return report
+}
+
+func (t *CapacityTotals) add(ci *ecs.ContainerInstance) {
+	t.Instances++
+	t.RegisteredCPU += resourceValue(ci.RegisteredResources, "CPU")
+	t.RemainingCPU += resourceValue(ci.RemainingResources, "CPU")
+	t.RegisteredMemory += resourceValue(ci.RegisteredResources, "MEMORY")
+	t.RemainingMemory += resourceValue(ci.RemainingResources, "MEMORY")
+	for _, r := range ci.RemainingResources {
+		if aws.StringValue(r.Name) == "PORTS" {
+			t.ReservedPorts += len(r.StringSetValue)
+		}
+	}
+}
+
+func sortedTotals(groups map[string]*CapacityTotals) []CapacityTotals {
+	totals := []CapacityTotals{}
+	for _, t := range groups {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Group < totals[j].Group })
+	return totals
+}
+
+func containerInstanceAttribute(ci *ecs.ContainerInstance, name string) string {
+	for _, a := range ci.Attributes {
+		if aws.StringValue(a.Name) == name {
+			return aws.StringValue(a.Value)
+		}
+	}
+	return ""
+}
+
+// TaskDefinitionReservation returns the CPU units and MiB of memory a task of the definition
+// reserves. Task-level sizes take precedence over the sum of the containers' sizes.
+func TaskDefinitionReservation(td *ecs.TaskDefinition) (cpu, memory int64) {
+	if td == nil {
+		return 0, 0
+	}
+	for _, c := range td.ContainerDefinitions {
+		cpu += aws.Int64Value(c.Cpu)
+		if c.Memory != nil {
+			memory += aws.Int64Value(c.Memory)
+		} else {
+			memory += aws.Int64Value(c.MemoryReservation)
+		}
+	}
+	if v, err := strconv.ParseInt(aws.StringValue(td.Cpu), 10, 64); err == nil {
+		cpu = v
+	}
+	if v, err := strconv.ParseInt(aws.StringValue(td.Memory), 10, 64); err == nil {
+		memory = v
+	}
+	return cpu, memory
+}
+
+// GetCapacityReport collects the container instances, services and task definitions of a cluster
+// and builds a capacity report.
+func GetCapacityReport(ctx context.Context, svc *ecs.ECS, clusterName string) (*CapacityReport, error) {
+	instances, err := listContainerInstances(ctx, svc, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	services, err := listServices(ctx, svc, clusterName, nil)
+	if err != nil {
+		return nil, err
+	}
+	arns := []string{}
+	for _, s := range services.Services {
+		arns = append(arns, aws.StringValue(s.TaskDefinition))
+	}
+	taskDefinitions, err := getTaskDefinitions(ctx, svc, arns)
+	if err != nil {
+		return nil, err
+	}
+	return NewCapacityReport(instances, services.Services, taskDefinitions), nil
+}
+
+// RenderCapacityReport writes the report in the given format, either table or json.
+func RenderCapacityReport(w io.Writer, report *CapacityReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	header := []string{"Group", "Instances", "CPU Used", "CPU Free", "Memory Used", "Memory Free", "Reserved Ports"}
+	totalsRow := func(t CapacityTotals) []string {
+		return []string{
+			t.Group,
+			strconv.Itoa(t.Instances),
+			formatUsage(t.RegisteredCPU-t.RemainingCPU, t.RegisteredCPU),
+			strconv.FormatInt(t.RemainingCPU, 10),
+			formatUsage(t.RegisteredMemory-t.RemainingMemory, t.RegisteredMemory),
+			strconv.FormatInt(t.RemainingMemory, 10),
+			strconv.Itoa(t.ReservedPorts),
+		}
+	}
+	renderTotals := func(title string, totals []CapacityTotals) {
+		fmt.Fprintln(w, title)
+		table := NewTable(w)
+		table.SetHeader(header)
+		for _, t := range totals {
+			table.Append(totalsRow(t))
+		}
+		table.Render()
+	}
+	renderTotals("Cluster", []CapacityTotals{report.Total})
+	renderTotals("By Instance Type", report.ByInstanceType)
+	renderTotals("By Availability Zone", report.ByAvailabilityZone)
+
+	fmt.Fprintln(w, "Largest Placeable Task")
+	table := NewTable(w)
+	table.SetHeader([]string{"Limited By", "CPU", "Memory", "Instance"})
+	for _, p := range []struct {
+		name string
+		task *PlaceableTask
+	}{{"Memory", report.LargestByMemory}, {"CPU", report.LargestByCPU}} {
+		if p.task != nil {
+			table.Append([]string{p.name, strconv.FormatInt(p.task.CPU, 10), strconv.FormatInt(p.task.Memory, 10), p.task.Instance})
+		}
+	}
+	table.Render()
+
+	fmt.Fprintln(w, "Service Reservations")
+	table = NewTable(w)
+	table.SetHeader([]string{"Service", "Launch Type", "Desired", "Task CPU", "Task Memory", "Total CPU", "Total Memory"})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	for _, r := range report.ServiceReservations {
+		table.Append([]string{
+			r.Service,
+			r.LaunchType,
+			strconv.FormatInt(r.DesiredCount, 10),
+			strconv.FormatInt(r.TaskCPU, 10),
+			strconv.FormatInt(r.TaskMemory, 10),
+			strconv.FormatInt(r.TotalCPU(), 10),
+			strconv.FormatInt(r.TotalMemory(), 10),
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func formatUsage(used, total int64) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%v (%.0f%%)", used, float64(used)*100/float64(total))
+}
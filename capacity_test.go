@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func capacityInstance(id, instanceType, az string, registered, remaining [2]int64, ports ...string) *ecs.ContainerInstance {
+	resources := func(r [2]int64) []*ecs.Resource {
+		return []*ecs.Resource{
+			{Name: aws.String("CPU"), IntegerValue: aws.Int64(r[0])},
+			{Name: aws.String("MEMORY"), IntegerValue: aws.Int64(r[1])},
+		}
+	}
+	return &ecs.ContainerInstance{
+		Ec2InstanceId:       aws.String(id),
+		Status:              aws.String("ACTIVE"),
+		RegisteredResources: resources(registered),
+		RemainingResources:  append(resources(remaining), &ecs.Resource{Name: aws.String("PORTS"), StringSetValue: aws.StringSlice(ports)}),
+		Attributes: []*ecs.Attribute{
+			{Name: aws.String("ecs.instance-type"), Value: aws.String(instanceType)},
+			{Name: aws.String("ecs.availability-zone"), Value: aws.String(az)},
+		},
+	}
+}
+
+func TestNewCapacityReport(t *testing.T) {
+	draining := capacityInstance("i-4", "m5.large", "us-east-1a", [2]int64{2048, 8192}, [2]int64{2048, 8192})
+	draining.Status = aws.String("DRAINING")
+	instances := []*ecs.ContainerInstance{
+		capacityInstance("i-1", "m5.large", "us-east-1a", [2]int64{2048, 8192}, [2]int64{1024, 2048}, "22", "80"),
+		capacityInstance("i-2", "m5.large", "us-east-1b", [2]int64{2048, 8192}, [2]int64{512, 4096}, "22"),
+		capacityInstance("i-3", "c5.xlarge", "us-east-1a", [2]int64{4096, 8192}, [2]int64{2048, 1024}, "22"),
+		draining,
+	}
+	services := []*ecs.Service{
+		{ServiceName: aws.String("small"), DesiredCount: aws.Int64(4), TaskDefinition: aws.String("arn:small")},
+		{ServiceName: aws.String("big"), DesiredCount: aws.Int64(2), TaskDefinition: aws.String("arn:big")},
+	}
+	taskDefinitions := map[string]*ecs.TaskDefinition{
+		"arn:small": {ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Cpu: aws.Int64(128), Memory: aws.Int64(256)},
+			{Cpu: aws.Int64(128), MemoryReservation: aws.Int64(128)},
+		}},
+		"arn:big": {Cpu: aws.String("1024"), Memory: aws.String("2048"), ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Cpu: aws.Int64(0), Memory: aws.Int64(512)},
+		}},
+	}
+	report := NewCapacityReport(instances, services, taskDefinitions)
+
+	total := report.Total
+	assertTrue(t, total.Instances == 3)
+	assertTrue(t, total.RegisteredCPU == 8192 && total.RemainingCPU == 3584)
+	assertTrue(t, total.RegisteredMemory == 24576 && total.RemainingMemory == 7168)
+	assertTrue(t, total.ReservedPorts == 4)
+
+	assertTrue(t, len(report.ByInstanceType) == 2)
+	assertTrue(t, report.ByInstanceType[0].Group == "c5.xlarge" && report.ByInstanceType[0].Instances == 1)
+	assertTrue(t, report.ByInstanceType[1].Group == "m5.large" && report.ByInstanceType[1].Instances == 2)
+	assertTrue(t, len(report.ByAvailabilityZone) == 2)
+	assertTrue(t, report.ByAvailabilityZone[0].Group == "us-east-1a" && report.ByAvailabilityZone[0].RemainingCPU == 3072)
+
+	assertTrue(t, report.LargestByMemory.Instance == "i-2" && report.LargestByMemory.Memory == 4096)
+	assertTrue(t, report.LargestByCPU.Instance == "i-3" && report.LargestByCPU.CPU == 2048)
+
+	assertTrue(t, len(report.ServiceReservations) == 2)
+	big, small := report.ServiceReservations[0], report.ServiceReservations[1]
+	assertTrue(t, big.Service == "big" && big.TotalCPU() == 2048 && big.TotalMemory() == 4096)
+	assertTrue(t, small.Service == "small" && small.TotalCPU() == 1024 && small.TotalMemory() == 1536)
+}
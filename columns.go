@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+)
+
+// ClusterColumns returns the columns the clusters command can show.
+func ClusterColumns(region string) []Column[*ecs.Cluster] {
+	return []Column[*ecs.Cluster]{
+		{Name: "name", Header: "Cluster Name", Value: func(c *ecs.Cluster) string { return aws.StringValue(c.ClusterName) }},
+		{Name: "instances", Header: "Container Instances", Value: func(c *ecs.Cluster) string { return formatCount(c.RegisteredContainerInstancesCount) }},
+		{Name: "services", Header: "Active Services", Value: func(c *ecs.Cluster) string { return formatCount(c.ActiveServicesCount) }},
+		{Name: "running", Header: "Running Tasks", Value: func(c *ecs.Cluster) string { return formatCount(c.RunningTasksCount) }},
+		{Name: "pending", Header: "Pending Tasks", Value: func(c *ecs.Cluster) string { return formatCount(c.PendingTasksCount) }},
+		{Name: "status", Header: "Status", Wide: true, Value: func(c *ecs.Cluster) string { return aws.StringValue(c.Status) }},
+		{Name: "arn", Header: "ARN", Wide: true, Value: func(c *ecs.Cluster) string { return aws.StringValue(c.ClusterArn) }},
+		{Name: "link", Header: "Link", Wide: true, Value: func(c *ecs.Cluster) string {
+			return ecsq.ClusterLink(region, aws.StringValue(c.ClusterName))
+		}},
+	}
+}
+
+// ServiceColumns returns the columns the services command can show.
+func ServiceColumns(region, cluster string) []Column[*ecs.Service] {
+	return []Column[*ecs.Service]{
+		{Name: "name", Header: "Service Name", Value: func(s *ecs.Service) string { return aws.StringValue(s.ServiceName) }},
+		{Name: "status", Header: "Status", Value: func(s *ecs.Service) string { return aws.StringValue(s.Status) }},
+		{Name: "desired", Header: "Desired", Value: func(s *ecs.Service) string { return formatCount(s.DesiredCount) }},
+		{Name: "running", Header: "Running", Value: func(s *ecs.Service) string { return formatCount(s.RunningCount) }},
+		{Name: "pending", Header: "Pending", Value: func(s *ecs.Service) string { return formatCount(s.PendingCount) }},
+		{Name: "launch-type", Header: "Launch Type", Wide: true, Value: func(s *ecs.Service) string { return aws.StringValue(s.LaunchType) }},
+		{Name: "task-definition", Header: "Task Definition", Wide: true, Value: func(s *ecs.Service) string {
+			return taskDefinitionRevision(aws.StringValue(s.TaskDefinition))
+		}},
+		{Name: "deployments", Header: "Deployments", Wide: true, Value: func(s *ecs.Service) string { return strconv.Itoa(len(s.Deployments)) }},
+		{Name: "created", Header: "Created", Wide: true, Value: func(s *ecs.Service) string { return formatTime(s.CreatedAt) }},
+		{Name: "arn", Header: "ARN", Wide: true, Value: func(s *ecs.Service) string { return aws.StringValue(s.ServiceArn) }},
+		{Name: "link", Header: "Link", Wide: true, Value: func(s *ecs.Service) string {
+			return ecsq.ServiceLink(region, cluster, aws.StringValue(s.ServiceName))
+		}},
+	}
+}
+
+// TagColumns returns a column for each tag key.
+func TagColumns[T any](keys []string, tags func(T) []*ecs.Tag) []Column[T] {
+	columns := []Column[T]{}
+	for _, key := range keys {
+		key := key
+		columns = append(columns, Column[T]{Name: "tag:" + key, Header: key, Value: func(row T) string {
+			value, _ := lookupTag(tags(row), key)
+			return value
+		}})
+	}
+	return columns
+}
+
+func formatCount(n *int64) string {
+	return strconv.FormatInt(aws.Int64Value(n), 10)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/olekukonko/tablewriter"
+)
+
+// APICallLog logs AWS API calls as they complete, and counts them per operation for a summary.
+type APICallLog struct {
+	W io.Writer
+	// Trace also logs each failed attempt that the SDK retries.
+	Trace bool
+
+	mu    sync.Mutex
+	stats map[string]*APICallStats
+}
+
+// APICallStats are the totals for one API operation.
+type APICallStats struct {
+	Service   string
+	Operation string
+	Calls     int
+	Retries   int
+	Errors    int
+	Latency   time.Duration
+}
+
+// NewAPICallLog returns a log that writes to w.
+func NewAPICallLog(w io.Writer, trace bool) *APICallLog {
+	return &APICallLog{W: w, Trace: trace, stats: map[string]*APICallStats{}}
+}
+
+// Install adds the log's handlers to the SDK handlers of a session or client. Clients created from
+// a session afterwards inherit them.
+func (l *APICallLog) Install(handlers *request.Handlers) {
+	handlers.Complete.PushBackNamed(request.NamedHandler{Name: "ecsq.APICallLog", Fn: l.complete})
+	if l.Trace {
+		handlers.AfterRetry.PushFrontNamed(request.NamedHandler{Name: "ecsq.APICallLog.AttemptFailed", Fn: l.attemptFailed})
+		handlers.AfterRetry.PushBackNamed(request.NamedHandler{Name: "ecsq.APICallLog.Retried", Fn: l.retried})
+	}
+}
+
+func (l *APICallLog) complete(r *request.Request) {
+	latency := time.Since(r.Time)
+	service, operation := r.ClientInfo.ServiceName, r.Operation.Name
+	line := fmt.Sprintf("[debug] %v.%v %v retries=%v", service, operation, latency.Round(time.Millisecond), r.RetryCount)
+	if r.RequestID != "" {
+		line += " request_id=" + r.RequestID
+	}
+	if r.Error != nil {
+		line += " error=" + errorCode(r.Error)
+	}
+	line += " " + RedactedParams(r.Params)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.W, line)
+	key := service + "." + operation
+	s, ok := l.stats[key]
+	if !ok {
+		s = &APICallStats{Service: service, Operation: operation}
+		l.stats[key] = s
+	}
+	s.Calls++
+	s.Retries += r.RetryCount
+	s.Latency += latency
+	if r.Error != nil {
+		s.Errors++
+	}
+}
+
+// attemptFailed runs after each failed attempt, before the SDK decides whether to retry it.
+func (l *APICallLog) attemptFailed(r *request.Request) {
+	if r.Error == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.W, "[trace] %v.%v attempt %v failed with %v\n", r.ClientInfo.ServiceName, r.Operation.Name, r.RetryCount+1, errorCode(r.Error))
+}
+
+// retried runs after the SDK's retry handler, which clears the error and waits out the delay if
+// the request is retried.
+func (l *APICallLog) retried(r *request.Request) {
+	if r.Error != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.W, "[trace] %v.%v retrying after %v\n", r.ClientInfo.ServiceName, r.Operation.Name, r.RetryDelay.Round(time.Millisecond))
+}
+
+func errorCode(err error) string {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code()
+	}
+	return strconv.Quote(err.Error())
+}
+
+// Stats returns the totals per operation, most called first.
+func (l *APICallLog) Stats() []*APICallStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := []*APICallStats{}
+	for _, s := range l.stats {
+		stats = append(stats, s)
+	}
+	MustParseSort("-calls,operation", APICallStatsSortKeys).Sort(stats)
+	return stats
+}
+
+// APICallStatsSortKeys are the keys the summary is sorted by.
+var APICallStatsSortKeys = []SortKey[*APICallStats]{
+	NumberKey("calls", func(s *APICallStats) int64 { return int64(s.Calls) }),
+	StringKey("operation", func(s *APICallStats) string { return s.Service + "." + s.Operation }),
+}
+
+// RenderSummary writes a table of the calls made per operation.
+func (l *APICallLog) RenderSummary(w io.Writer) {
+	stats := l.Stats()
+	if len(stats) == 0 {
+		return
+	}
+	header := []string{"Operation", "Calls", "Retries", "Errors", "Total Time", "Average"}
+	rows := [][]string{}
+	for _, s := range stats {
+		rows = append(rows, []string{
+			s.Service + "." + s.Operation,
+			strconv.Itoa(s.Calls),
+			strconv.Itoa(s.Retries),
+			strconv.Itoa(s.Errors),
+			s.Latency.Round(time.Millisecond).String(),
+			(s.Latency / time.Duration(s.Calls)).Round(time.Millisecond).String(),
+		})
+	}
+	fmt.Fprintln(w, "AWS API calls:")
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(rows)
+	table.Render()
+}
+
+// RedactedParams returns the parameters of an API call as JSON, without the unset ones, and with
+// values that look like secrets replaced. A value is redacted if its key, or the Name next to it in
+// a name/value pair such as an environment variable, suggests a secret, or if it has high entropy.
+func RedactedParams(params interface{}) string {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return "{}"
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(redact(v))
+	return strings.TrimSpace(buf.String())
+}
+
+const redactedValue = "<redacted>"
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Parameters use Go field names, and API bodies use lower case names.
+		name, _ := v["Name"].(string)
+		if lower, ok := v["name"].(string); ok {
+			name = lower
+		}
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+			if s, ok := value.(string); ok {
+				if SecretReason(key, s) != "" || (strings.EqualFold(key, "Value") && SecretReason(name, s) != "") {
+					v[key] = redactedValue
+				}
+				continue
+			}
+			v[key] = redact(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			if s, ok := value.(string); ok && SecretReason("", s) != "" {
+				v[i] = redactedValue
+				continue
+			}
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
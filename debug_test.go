@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestAPICallLog(t *testing.T) {
+	t.Setenv("AWS_CA_BUNDLE", "")
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{"X-Amzn-Requestid": []string{"req-123"}}
+		if strings.HasSuffix(req.Header.Get("X-Amz-Target"), ".DescribeClusters") {
+			body := `{"__type":"AccessDeniedException","message":"not authorized"}`
+			return &http.Response{StatusCode: 400, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(strings.NewReader(`{"clusterArns":[]}`))}, nil
+	})
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		HTTPClient:  &http.Client{Transport: transport},
+	}))
+	var out bytes.Buffer
+	log := NewAPICallLog(&out, false)
+	log.Install(&sess.Handlers)
+	svc := ecs.New(sess)
+	svc.ListClusters(&ecs.ListClustersInput{})
+	svc.ListClusters(&ecs.ListClustersInput{})
+	svc.DescribeClusters(&ecs.DescribeClustersInput{Clusters: []*string{aws.String("ecs-prod")}})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assertTrue(t, len(lines) == 3)
+	assertTrue(t, strings.HasPrefix(lines[0], "[debug] ecs.ListClusters "))
+	assertTrue(t, strings.Contains(lines[0], "request_id=req-123"))
+	assertTrue(t, strings.Contains(lines[2], "error=AccessDeniedException"))
+	assertTrue(t, strings.HasSuffix(lines[2], ` {"Clusters":["ecs-prod"]}`))
+
+	stats := log.Stats()
+	assertTrue(t, len(stats) == 2)
+	assertTrue(t, stats[0].Operation == "ListClusters" && stats[0].Calls == 2 && stats[0].Errors == 0)
+	assertTrue(t, stats[1].Operation == "DescribeClusters" && stats[1].Errors == 1)
+}
+
+func TestRedactedParams(t *testing.T) {
+	params := RedactedParams(&ecs.ContainerDefinition{
+		Name: aws.String("app"),
+		Environment: []*ecs.KeyValuePair{
+			{Name: aws.String("DB_PASSWORD"), Value: aws.String("hunter2")},
+			{Name: aws.String("LOG_LEVEL"), Value: aws.String("info")},
+		},
+		Command: []*string{aws.String("--token"), aws.String("kX9vQ2mZ7rT4wY1pL8nB3cF6")},
+	})
+	assertFalse(t, strings.Contains(params, "hunter2"))
+	assertFalse(t, strings.Contains(params, "kX9vQ2mZ7rT4wY1pL8nB3cF6"))
+	assertTrue(t, strings.Contains(params, `{"Name":"LOG_LEVEL","Value":"info"}`))
+	assertTrue(t, strings.Contains(params, `{"Name":"DB_PASSWORD","Value":"<redacted>"}`))
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ServiceDiscovery is how other services find a service: the Cloud Map services its tasks are
+// registered in, and the endpoints it serves with Service Connect.
+type ServiceDiscovery struct {
+	Registries     []*CloudMapRegistry `json:"registries"`
+	ServiceConnect *ServiceConnect     `json:"serviceConnect,omitempty"`
+}
+
+// CloudMapRegistry is a Cloud Map service that a service registers its tasks in.
+type CloudMapRegistry struct {
+	RegistryArn   string `json:"registryArn"`
+	Namespace     string `json:"namespace"`
+	NamespaceType string `json:"namespaceType"`
+	Service       string `json:"service"`
+	// Hostname is the DNS name the service resolves as. It is empty for HTTP namespaces, which are
+	// only discoverable with the Cloud Map API.
+	Hostname      string             `json:"hostname,omitempty"`
+	DNSRecords    []string           `json:"dnsRecords,omitempty"`
+	ContainerName string             `json:"containerName,omitempty"`
+	ContainerPort int64              `json:"containerPort,omitempty"`
+	Instances     []CloudMapInstance `json:"instances,omitempty"`
+}
+
+// CloudMapInstance is a task registered in Cloud Map.
+type CloudMapInstance struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// Health is HEALTHY, UNHEALTHY or UNKNOWN, or empty if the Cloud Map service has no health
+	// checks.
+	Health string `json:"health,omitempty"`
+}
+
+// ServiceConnect is the Service Connect configuration of a service's primary deployment.
+type ServiceConnect struct {
+	Namespace string `json:"namespace"`
+	// Endpoints are empty if the service is only a Service Connect client.
+	Endpoints []ServiceConnectEndpoint `json:"endpoints"`
+}
+
+// ServiceConnectEndpoint is a port a service serves with Service Connect.
+type ServiceConnectEndpoint struct {
+	PortName      string `json:"portName"`
+	DiscoveryName string `json:"discoveryName"`
+	// ClientAliases are the host:port addresses that other services in the namespace use.
+	ClientAliases []string `json:"clientAliases"`
+}
+
+// CloudMap looks up Cloud Map namespaces and services, each once.
+type CloudMap struct {
+	API servicediscoveryiface.ServiceDiscoveryAPI
+
+	namespaces map[string]*servicediscovery.Namespace
+	services   map[string]*servicediscovery.Service
+}
+
+// NewCloudMap returns a lookup that calls the given Cloud Map API.
+func NewCloudMap(api servicediscoveryiface.ServiceDiscoveryAPI) *CloudMap {
+	return &CloudMap{
+		API:        api,
+		namespaces: map[string]*servicediscovery.Namespace{},
+		services:   map[string]*servicediscovery.Service{},
+	}
+}
+
+// Namespace describes a namespace by ID.
+func (c *CloudMap) Namespace(ctx context.Context, id string) (*servicediscovery.Namespace, error) {
+	if ns, ok := c.namespaces[id]; ok {
+		return ns, nil
+	}
+	result, err := c.API.GetNamespaceWithContext(ctx, &servicediscovery.GetNamespaceInput{Id: aws.String(id)})
+	if err != nil {
+		return nil, err
+	}
+	c.namespaces[id] = result.Namespace
+	return result.Namespace, nil
+}
+
+// Service describes a Cloud Map service by ID.
+func (c *CloudMap) Service(ctx context.Context, id string) (*servicediscovery.Service, error) {
+	if s, ok := c.services[id]; ok {
+		return s, nil
+	}
+	result, err := c.API.GetServiceWithContext(ctx, &servicediscovery.GetServiceInput{Id: aws.String(id)})
+	if err != nil {
+		return nil, err
+	}
+	c.services[id] = result.Service
+	return result.Service, nil
+}
+
+// Instances lists the instances registered in a Cloud Map service, with their health if the
+// service has health checks.
+func (c *CloudMap) Instances(ctx context.Context, service *servicediscovery.Service) ([]CloudMapInstance, error) {
+	instances := []CloudMapInstance{}
+	err := c.API.ListInstancesPagesWithContext(ctx, &servicediscovery.ListInstancesInput{ServiceId: service.Id},
+		func(page *servicediscovery.ListInstancesOutput, lastPage bool) bool {
+			for _, i := range page.Instances {
+				instances = append(instances, CloudMapInstance{ID: aws.StringValue(i.Id), Address: instanceAddress(i.Attributes)})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	if service.HealthCheckConfig == nil && service.HealthCheckCustomConfig == nil {
+		return instances, nil
+	}
+	health := map[string]string{}
+	err = c.API.GetInstancesHealthStatusPagesWithContext(ctx, &servicediscovery.GetInstancesHealthStatusInput{ServiceId: service.Id},
+		func(page *servicediscovery.GetInstancesHealthStatusOutput, lastPage bool) bool {
+			for id, status := range page.Status {
+				health[id] = aws.StringValue(status)
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	for i := range instances {
+		instances[i].Health = health[instances[i].ID]
+	}
+	return instances, nil
+}
+
+// instanceAddress returns the IP:port an instance is registered with, from the attributes ECS sets.
+func instanceAddress(attributes map[string]*string) string {
+	address := aws.StringValue(attributes["AWS_INSTANCE_IPV4"])
+	if port := aws.StringValue(attributes["AWS_INSTANCE_PORT"]); port != "" {
+		address += ":" + port
+	}
+	return address
+}
+
+// GetServiceDiscovery describes the Cloud Map registries and Service Connect configuration of a
+// service. Registered instances are only listed if withInstances is set. It returns nil if the
+// service uses neither.
+func GetServiceDiscovery(ctx context.Context, cloudMap *CloudMap, service *ecs.Service, withInstances bool) (*ServiceDiscovery, error) {
+	discovery := &ServiceDiscovery{Registries: []*CloudMapRegistry{}}
+	for _, r := range service.ServiceRegistries {
+		registry, err := getCloudMapRegistry(ctx, cloudMap, r, withInstances)
+		if err != nil {
+			return nil, err
+		}
+		discovery.Registries = append(discovery.Registries, registry)
+	}
+	if config := ServiceConnectConfiguration(service); config != nil && aws.BoolValue(config.Enabled) {
+		namespace := aws.StringValue(config.Namespace)
+		// The namespace is given by name or ARN, and the hostnames are made from its name.
+		if arn := ecsq.ParseARN(namespace); arn.Type == "namespace" {
+			ns, err := cloudMap.Namespace(ctx, arn.Name)
+			if err != nil {
+				return nil, err
+			}
+			namespace = aws.StringValue(ns.Name)
+		}
+		discovery.ServiceConnect = NewServiceConnect(namespace, config.Services)
+	}
+	if len(discovery.Registries) == 0 && discovery.ServiceConnect == nil {
+		return nil, nil
+	}
+	return discovery, nil
+}
+
+func getCloudMapRegistry(ctx context.Context, cloudMap *CloudMap, r *ecs.ServiceRegistry, withInstances bool) (*CloudMapRegistry, error) {
+	registry := &CloudMapRegistry{
+		RegistryArn:   aws.StringValue(r.RegistryArn),
+		ContainerName: aws.StringValue(r.ContainerName),
+		ContainerPort: aws.Int64Value(r.ContainerPort),
+	}
+	service, err := cloudMap.Service(ctx, ecsq.ParseARN(registry.RegistryArn).Name)
+	if err != nil {
+		return nil, err
+	}
+	registry.Service = aws.StringValue(service.Name)
+	ns, err := cloudMap.Namespace(ctx, aws.StringValue(service.NamespaceId))
+	if err != nil {
+		return nil, err
+	}
+	registry.Namespace = aws.StringValue(ns.Name)
+	registry.NamespaceType = aws.StringValue(ns.Type)
+	if service.DnsConfig != nil && registry.NamespaceType != servicediscovery.NamespaceTypeHttp {
+		registry.Hostname = registry.Service + "." + registry.Namespace
+		for _, record := range service.DnsConfig.DnsRecords {
+			registry.DNSRecords = append(registry.DNSRecords, fmt.Sprintf("%v %vs", aws.StringValue(record.Type), aws.Int64Value(record.TTL)))
+		}
+	}
+	if withInstances {
+		registry.Instances, err = cloudMap.Instances(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// ServiceConnectConfiguration returns the Service Connect configuration of the service's primary
+// deployment, which is where ECS reports it, or nil if there is none.
+func ServiceConnectConfiguration(service *ecs.Service) *ecs.ServiceConnectConfiguration {
+	for _, d := range service.Deployments {
+		if aws.StringValue(d.Status) == "PRIMARY" {
+			return d.ServiceConnectConfiguration
+		}
+	}
+	return nil
+}
+
+// NewServiceConnect works out the addresses of each Service Connect service. The discovery name
+// defaults to the port name, and a client alias without a DNS name to <discovery name>.<namespace>.
+func NewServiceConnect(namespace string, services []*ecs.ServiceConnectService) *ServiceConnect {
+	sc := &ServiceConnect{Namespace: namespace, Endpoints: []ServiceConnectEndpoint{}}
+	for _, s := range services {
+		endpoint := ServiceConnectEndpoint{
+			PortName:      aws.StringValue(s.PortName),
+			DiscoveryName: aws.StringValue(s.DiscoveryName),
+			ClientAliases: []string{},
+		}
+		if endpoint.DiscoveryName == "" {
+			endpoint.DiscoveryName = endpoint.PortName
+		}
+		for _, alias := range s.ClientAliases {
+			host := aws.StringValue(alias.DnsName)
+			if host == "" {
+				host = endpoint.DiscoveryName + "." + namespace
+			}
+			endpoint.ClientAliases = append(endpoint.ClientAliases, host+":"+strconv.FormatInt(aws.Int64Value(alias.Port), 10))
+		}
+		sc.Endpoints = append(sc.Endpoints, endpoint)
+	}
+	return sc
+}
+
+// RenderServiceDiscovery writes the service discovery section of the service command.
+func RenderServiceDiscovery(w io.Writer, discovery *ServiceDiscovery) {
+	if discovery == nil {
+		return
+	}
+	for _, r := range discovery.Registries {
+		fmt.Fprintln(w, "Service Discovery")
+		table := NewTable(w)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.Append([]string{"Namespace", fmt.Sprintf("%v (%v)", r.Namespace, r.NamespaceType)})
+		table.Append([]string{"Service", r.Service})
+		if r.Hostname != "" {
+			table.Append([]string{"Hostname", r.Hostname})
+			table.Append([]string{"DNS Records", strings.Join(r.DNSRecords, ", ")})
+		}
+		if r.ContainerName != "" {
+			table.Append([]string{"Container", fmt.Sprintf("%v:%v", r.ContainerName, r.ContainerPort)})
+		}
+		table.Render()
+		if len(r.Instances) > 0 {
+			table = NewTable(w)
+			table.SetHeader([]string{"Instance", "Address", "Health"})
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			for _, i := range r.Instances {
+				health := i.Health
+				if health == "" {
+					health = "-"
+				}
+				table.Append([]string{i.ID, i.Address, health})
+			}
+			table.Render()
+		}
+	}
+	if sc := discovery.ServiceConnect; sc != nil {
+		fmt.Fprintf(w, "Service Connect (namespace %v)\n", sc.Namespace)
+		if len(sc.Endpoints) == 0 {
+			fmt.Fprintln(w, "Client only, the service does not serve any endpoints")
+			return
+		}
+		table := NewTable(w)
+		table.SetHeader([]string{"Port Name", "Discovery Name", "Client Aliases"})
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		for _, e := range sc.Endpoints {
+			table.Append([]string{e.PortName, e.DiscoveryName, formatList(e.ClientAliases)})
+		}
+		table.Render()
+	}
+}
+
+// DiscoveryEntry is one name a service can be reached by.
+type DiscoveryEntry struct {
+	Service string `json:"service"`
+	// Type is "cloud-map" or "service-connect".
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	// Name is the Cloud Map service, or the Service Connect discovery name.
+	Name string `json:"name"`
+	// Addresses are the hostnames, or host:port addresses for Service Connect, that other services
+	// use.
+	Addresses []string `json:"addresses"`
+}
+
+// DiscoveryEntries lists the names a service can be reached by.
+func DiscoveryEntries(service string, discovery *ServiceDiscovery) []DiscoveryEntry {
+	entries := []DiscoveryEntry{}
+	if discovery == nil {
+		return entries
+	}
+	for _, r := range discovery.Registries {
+		entry := DiscoveryEntry{Service: service, Type: "cloud-map", Namespace: r.Namespace, Name: r.Service, Addresses: []string{}}
+		if r.Hostname != "" {
+			entry.Addresses = append(entry.Addresses, r.Hostname)
+		}
+		entries = append(entries, entry)
+	}
+	if sc := discovery.ServiceConnect; sc != nil {
+		for _, e := range sc.Endpoints {
+			entries = append(entries, DiscoveryEntry{
+				Service:   service,
+				Type:      "service-connect",
+				Namespace: sc.Namespace,
+				Name:      e.DiscoveryName,
+				Addresses: e.ClientAliases,
+			})
+		}
+	}
+	return entries
+}
+
+// GetClusterDiscovery lists the names every service in the cluster can be reached by, sorted by
+// service.
+func GetClusterDiscovery(ctx context.Context, svc *ecs.ECS, cloudMap *CloudMap, clusterName string) ([]DiscoveryEntry, error) {
+	services, err := listServices(ctx, svc, clusterName, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := []DiscoveryEntry{}
+	for _, service := range services.Services {
+		discovery, err := GetServiceDiscovery(ctx, cloudMap, service, false)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", aws.StringValue(service.ServiceName), err)
+		}
+		entries = append(entries, DiscoveryEntries(ShortServiceName(clusterName, aws.StringValue(service.ServiceName)), discovery)...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Service < entries[j].Service })
+	return entries, nil
+}
+
+// RenderDiscoveryEntries writes the entries as a table, or as JSON.
+func RenderDiscoveryEntries(w io.Writer, entries []DiscoveryEntry, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No services use service discovery or Service Connect")
+		return nil
+	}
+	header := []string{"Service", "Type", "Namespace", "Name", "Addresses"}
+	rows := [][]string{}
+	for _, e := range entries {
+		rows = append(rows, []string{e.Service, e.Type, e.Namespace, e.Name, formatList(e.Addresses)})
+	}
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+	table.Render()
+	return nil
+}
+
+func formatList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
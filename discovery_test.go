@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+)
+
+type fakeCloudMap struct {
+	servicediscoveryiface.ServiceDiscoveryAPI
+	namespaces map[string]*servicediscovery.Namespace
+	services   map[string]*servicediscovery.Service
+	calls      int
+}
+
+func (f *fakeCloudMap) GetNamespaceWithContext(ctx aws.Context, input *servicediscovery.GetNamespaceInput, opts ...request.Option) (*servicediscovery.GetNamespaceOutput, error) {
+	f.calls++
+	return &servicediscovery.GetNamespaceOutput{Namespace: f.namespaces[aws.StringValue(input.Id)]}, nil
+}
+
+func (f *fakeCloudMap) GetServiceWithContext(ctx aws.Context, input *servicediscovery.GetServiceInput, opts ...request.Option) (*servicediscovery.GetServiceOutput, error) {
+	f.calls++
+	return &servicediscovery.GetServiceOutput{Service: f.services[aws.StringValue(input.Id)]}, nil
+}
+
+func TestGetServiceDiscovery(t *testing.T) {
+	api := &fakeCloudMap{
+		namespaces: map[string]*servicediscovery.Namespace{
+			"ns-dns":  {Id: aws.String("ns-dns"), Name: aws.String("internal.local"), Type: aws.String("DNS_PRIVATE")},
+			"ns-http": {Id: aws.String("ns-http"), Name: aws.String("apps"), Type: aws.String("HTTP")},
+		},
+		services: map[string]*servicediscovery.Service{
+			"srv-dns": {Id: aws.String("srv-dns"), Name: aws.String("applepicker"), NamespaceId: aws.String("ns-dns"),
+				DnsConfig: &servicediscovery.DnsConfig{DnsRecords: []*servicediscovery.DnsRecord{{Type: aws.String("A"), TTL: aws.Int64(10)}}}},
+			"srv-http": {Id: aws.String("srv-http"), Name: aws.String("applepicker"), NamespaceId: aws.String("ns-http")},
+		},
+	}
+	cloudMap := NewCloudMap(api)
+	service := &ecs.Service{
+		ServiceRegistries: []*ecs.ServiceRegistry{
+			{RegistryArn: aws.String("arn:aws:servicediscovery:us-west-2:123456789012:service/srv-dns")},
+			{RegistryArn: aws.String("arn:aws:servicediscovery:us-west-2:123456789012:service/srv-http")},
+		},
+		Deployments: []*ecs.Deployment{
+			{Status: aws.String("ACTIVE")},
+			{Status: aws.String("PRIMARY"), ServiceConnectConfiguration: &ecs.ServiceConnectConfiguration{
+				Enabled:   aws.Bool(true),
+				Namespace: aws.String("arn:aws:servicediscovery:us-west-2:123456789012:namespace/ns-dns"),
+				Services: []*ecs.ServiceConnectService{{
+					PortName:      aws.String("http"),
+					DiscoveryName: aws.String("applepicker-http"),
+					ClientAliases: []*ecs.ServiceConnectClientAlias{
+						{Port: aws.Int64(80)},
+						{Port: aws.Int64(8080), DnsName: aws.String("applepicker")},
+					},
+				}},
+			}},
+		},
+	}
+	discovery, err := GetServiceDiscovery(context.Background(), cloudMap, service, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, len(discovery.Registries) == 2)
+	assertTrue(t, discovery.Registries[0].Hostname == "applepicker.internal.local")
+	assertTrue(t, discovery.Registries[0].DNSRecords[0] == "A 10s")
+	assertTrue(t, discovery.Registries[1].Hostname == "")
+	assertTrue(t, discovery.ServiceConnect.Namespace == "internal.local")
+	aliases := discovery.ServiceConnect.Endpoints[0].ClientAliases
+	assertTrue(t, aliases[0] == "applepicker-http.internal.local:80")
+	assertTrue(t, aliases[1] == "applepicker:8080")
+	// Namespaces and services are only looked up once.
+	assertTrue(t, api.calls == 4)
+
+	entries := DiscoveryEntries("applepicker", discovery)
+	assertTrue(t, len(entries) == 3)
+	assertTrue(t, entries[1].Type == "cloud-map" && len(entries[1].Addresses) == 0)
+	assertTrue(t, entries[2].Type == "service-connect" && entries[2].Name == "applepicker-http")
+
+	discovery, err = GetServiceDiscovery(context.Background(), cloudMap, &ecs.Service{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, discovery == nil)
+}
+
+func TestNewServiceConnect(t *testing.T) {
+	sc := NewServiceConnect("internal.local", []*ecs.ServiceConnectService{{
+		PortName:      aws.String("grpc"),
+		ClientAliases: []*ecs.ServiceConnectClientAlias{{Port: aws.Int64(9090)}},
+	}})
+	assertTrue(t, sc.Endpoints[0].DiscoveryName == "grpc")
+	assertTrue(t, sc.Endpoints[0].ClientAliases[0] == "grpc.internal.local:9090")
+
+	sc = NewServiceConnect("internal.local", nil)
+	assertTrue(t, len(sc.Endpoints) == 0)
+}
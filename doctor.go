@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Severity ranks doctor findings. Lower values are more severe.
+type Severity int
+
+// Finding severities
+const (
+	SeverityCritical Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityCritical:
+		return "CRITICAL"
+	case SeverityWarning:
+		return "WARNING"
+	}
+	return "INFO"
+}
+
+// MarshalJSON renders the severity by name.
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Finding is a problem found by a doctor check.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Resource string   `json:"resource"`
+	Message  string   `json:"message"`
+}
+
+// ClusterState is everything the doctor checks look at.
+type ClusterState struct {
+	Services           []*ecs.Service
+	ContainerInstances []*ecs.ContainerInstance
+	StoppedTasks       []*ecs.Task
+	Now                time.Time
+}
+
+// DoctorOptions tunes the thresholds of the doctor checks.
+type DoctorOptions struct {
+	// StuckDeploymentAge is how long a deployment can be in progress before it is considered stuck.
+	StuckDeploymentAge time.Duration
+	// EventWindow is how far back service events are considered.
+	EventWindow time.Duration
+	// PlacementFailures is how many "unable to place a task" events within the window are reported.
+	PlacementFailures int
+	// TaskFailures is how many tasks of a service stopping with a non-zero exit code are reported.
+	TaskFailures int
+}
+
+// DefaultDoctorOptions are the default thresholds of the doctor checks.
+var DefaultDoctorOptions = DoctorOptions{
+	StuckDeploymentAge: 30 * time.Minute,
+	EventWindow:        time.Hour,
+	PlacementFailures:  2,
+	TaskFailures:       2,
+}
+
+type doctorCheck struct {
+	name string
+	run  func(state *ClusterState, opts DoctorOptions) []Finding
+}
+
+var doctorChecks = []doctorCheck{
+	{"service-capacity", checkServiceCapacity},
+	{"stuck-deployment", checkStuckDeployments},
+	{"placement-failure", checkPlacementFailures},
+	{"instance-agent", checkContainerInstanceAgents},
+	{"instance-resources", checkContainerInstanceResources},
+	{"task-failures", checkTaskFailures},
+}
+
+// RunDoctor runs every check against the cluster state, and returns the findings ranked by
+// severity.
+func RunDoctor(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	for _, check := range doctorChecks {
+		for _, f := range check.run(state, opts) {
+			f.Check = check.name
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity < findings[j].Severity
+	})
+	return findings
+}
+
+// HasCritical returns whether any of the findings are critical.
+func HasCritical(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityCritical {
+			return true
+		}
+	}
+	return false
+}
+
+func checkServiceCapacity(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	for _, s := range state.Services {
+		running, desired := aws.Int64Value(s.RunningCount), aws.Int64Value(s.DesiredCount)
+		if running >= desired {
+			continue
+		}
+		severity := SeverityWarning
+		if running == 0 {
+			severity = SeverityCritical
+		}
+		findings = append(findings, Finding{
+			Severity: severity,
+			Resource: aws.StringValue(s.ServiceName),
+			Message:  fmt.Sprintf("running %v of %v desired tasks", running, desired),
+		})
+	}
+	return findings
+}
+
+func checkStuckDeployments(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	for _, s := range state.Services {
+		for _, d := range s.Deployments {
+			rollout := aws.StringValue(d.RolloutState)
+			age := state.Now.Sub(aws.TimeValue(d.CreatedAt)).Round(time.Minute)
+			switch {
+			case rollout == ecs.DeploymentRolloutStateFailed:
+				findings = append(findings, Finding{
+					Severity: SeverityCritical,
+					Resource: aws.StringValue(s.ServiceName),
+					Message:  fmt.Sprintf("deployment %v failed: %v", aws.StringValue(d.Id), aws.StringValue(d.RolloutStateReason)),
+				})
+			case aws.StringValue(d.Status) == "PRIMARY" && age > opts.StuckDeploymentAge &&
+				(len(s.Deployments) > 1 || rollout == ecs.DeploymentRolloutStateInProgress):
+				findings = append(findings, Finding{
+					Severity: SeverityWarning,
+					Resource: aws.StringValue(s.ServiceName),
+					Message: fmt.Sprintf("deployment %v has been in progress for %v, running %v of %v tasks",
+						aws.StringValue(d.Id), age, aws.Int64Value(d.RunningCount), aws.Int64Value(d.DesiredCount)),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func checkPlacementFailures(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	for _, s := range state.Services {
+		count := 0
+		var last *ecs.ServiceEvent
+		for _, e := range s.Events {
+			if state.Now.Sub(aws.TimeValue(e.CreatedAt)) > opts.EventWindow {
+				continue
+			}
+			if strings.Contains(aws.StringValue(e.Message), "unable to place a task") {
+				count++
+				if last == nil || e.CreatedAt.After(*last.CreatedAt) {
+					last = e
+				}
+			}
+		}
+		if count >= opts.PlacementFailures {
+			findings = append(findings, Finding{
+				Severity: SeverityCritical,
+				Resource: aws.StringValue(s.ServiceName),
+				Message:  fmt.Sprintf("%v placement failures in the last %v, latest: %v", count, opts.EventWindow, aws.StringValue(last.Message)),
+			})
+		}
+	}
+	return findings
+}
+
+func checkContainerInstanceAgents(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	latest := ""
+	for _, ci := range state.ContainerInstances {
+		if v := agentVersion(ci); compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	for _, ci := range state.ContainerInstances {
+		resource := containerInstanceName(ci)
+		if aws.StringValue(ci.Status) == ecs.ContainerInstanceStatusActive && !aws.BoolValue(ci.AgentConnected) {
+			findings = append(findings, Finding{
+				Severity: SeverityCritical,
+				Resource: resource,
+				Message:  "container agent is disconnected",
+			})
+		}
+		if v := agentVersion(ci); compareVersions(v, latest) < 0 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Resource: resource,
+				Message:  fmt.Sprintf("container agent %v is older than %v used elsewhere in the cluster", v, latest),
+			})
+		}
+	}
+	return findings
+}
+
+func checkContainerInstanceResources(state *ClusterState, opts DoctorOptions) []Finding {
+	findings := []Finding{}
+	for _, ci := range state.ContainerInstances {
+		if aws.StringValue(ci.Status) != ecs.ContainerInstanceStatusActive {
+			continue
+		}
+		exhausted := []string{}
+		for _, name := range []string{"CPU", "MEMORY"} {
+			if resourceValue(ci.RemainingResources, name) <= 0 {
+				exhausted = append(exhausted, name)
+			}
+		}
+		if len(exhausted) > 0 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Resource: containerInstanceName(ci),
+				Message:  fmt.Sprintf("no remaining %v", strings.Join(exhausted, " or ")),
+			})
+		}
+	}
+	return findings
+}
+
+func checkTaskFailures(state *ClusterState, opts DoctorOptions) []Finding {
+	type failures struct {
+		count     int
+		exitCode  int64
+		reason    string
+		stoppedAt time.Time
+	}
+	byGroup := map[string]*failures{}
+	groups := []string{}
+	for _, task := range state.StoppedTasks {
+		if stoppedOnPurpose(task) {
+			continue
+		}
+		for _, c := range task.Containers {
+			if c.ExitCode == nil || *c.ExitCode == 0 {
+				continue
+			}
+			group := aws.StringValue(task.Group)
+			f, ok := byGroup[group]
+			if !ok {
+				f = &failures{}
+				byGroup[group] = f
+				groups = append(groups, group)
+			}
+			f.count++
+			if stoppedAt := aws.TimeValue(task.StoppedAt); !stoppedAt.Before(f.stoppedAt) {
+				f.exitCode = *c.ExitCode
+				f.reason = aws.StringValue(task.StoppedReason)
+				f.stoppedAt = stoppedAt
+			}
+			break
+		}
+	}
+	sort.Strings(groups)
+	findings := []Finding{}
+	for _, group := range groups {
+		f := byGroup[group]
+		if f.count < opts.TaskFailures {
+			continue
+		}
+		findings = append(findings, Finding{
+			Severity: SeverityCritical,
+			Resource: strings.TrimPrefix(group, "service:"),
+			Message:  fmt.Sprintf("%v tasks stopped with a non-zero exit code, latest exit code %v: %v", f.count, f.exitCode, f.reason),
+		})
+	}
+	return findings
+}
+
+// stoppedOnPurpose returns whether a task was stopped by a user, or by the scheduler during a
+// deployment or scale-in, rather than because it failed. Its containers are killed, so they exit
+// with 137 or 143. Tasks the scheduler stops for failing health checks are still failures.
+func stoppedOnPurpose(task *ecs.Task) bool {
+	reason := aws.StringValue(task.StoppedReason)
+	if strings.Contains(strings.ToLower(reason), "health check") {
+		return false
+	}
+	switch aws.StringValue(task.StopCode) {
+	case ecs.TaskStopCodeServiceSchedulerInitiated, ecs.TaskStopCodeUserInitiated:
+		return true
+	}
+	return strings.Contains(reason, "(deployment ")
+}
+
+func agentVersion(ci *ecs.ContainerInstance) string {
+	if ci.VersionInfo == nil {
+		return ""
+	}
+	return aws.StringValue(ci.VersionInfo.AgentVersion)
+}
+
+func containerInstanceName(ci *ecs.ContainerInstance) string {
+	if id := aws.StringValue(ci.Ec2InstanceId); id != "" {
+		return id
+	}
+	return ecsq.ParseARN(aws.StringValue(ci.ContainerInstanceArn)).Name
+}
+
+// compareVersions compares dotted version numbers like 1.68.2. Empty versions sort first.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb int
+		if i < len(pa) {
+			va, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			vb, _ = strconv.Atoi(pb[i])
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a == "" && b != "":
+		return -1
+	case a != "" && b == "":
+		return 1
+	}
+	return 0
+}
+
+// GetClusterState collects the services, container instances and stopped tasks of a cluster.
+func GetClusterState(ctx context.Context, svc *ecs.ECS, clusterName string) (*ClusterState, error) {
+	state := &ClusterState{Now: time.Now()}
+	services, err := listServices(ctx, svc, clusterName, nil)
+	if err != nil {
+		return nil, err
+	}
+	state.Services = services.Services
+	state.ContainerInstances, err = listContainerInstances(ctx, svc, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	stoppedArns, err := getTasksArns(ctx, svc, clusterName, "", ecs.DesiredStatusStopped)
+	if err != nil {
+		return nil, err
+	}
+	stopped, err := describeTasks(ctx, svc, clusterName, stoppedArns)
+	if err != nil {
+		return nil, err
+	}
+	state.StoppedTasks = stopped.Tasks
+	return state, nil
+}
+
+// RenderFindings writes the findings in the given format, either table or json.
+func RenderFindings(w io.Writer, findings []Finding, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found")
+		return nil
+	}
+	header := []string{"Severity", "Check", "Resource", "Finding"}
+	rows := [][]string{}
+	for _, f := range findings {
+		rows = append(rows, []string{f.Severity.String(), f.Check, f.Resource, f.Message})
+	}
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+	table.Render()
+	return nil
+}
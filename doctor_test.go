@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestRunDoctor(t *testing.T) {
+	now := time.Now()
+	state := &ClusterState{
+		Now: now,
+		Services: []*ecs.Service{
+			{ServiceName: aws.String("healthy"), DesiredCount: aws.Int64(2), RunningCount: aws.Int64(2)},
+			{
+				ServiceName:  aws.String("deploying"),
+				DesiredCount: aws.Int64(2),
+				RunningCount: aws.Int64(1),
+				Deployments: []*ecs.Deployment{
+					{Id: aws.String("ecs-svc/1"), Status: aws.String("PRIMARY"), CreatedAt: aws.Time(now.Add(-2 * time.Hour))},
+					{Id: aws.String("ecs-svc/0"), Status: aws.String("ACTIVE"), CreatedAt: aws.Time(now.Add(-48 * time.Hour))},
+				},
+				Events: []*ecs.ServiceEvent{
+					{CreatedAt: aws.Time(now.Add(-time.Minute)), Message: aws.String("(service deploying) was unable to place a task because no container instance met all of its requirements.")},
+					{CreatedAt: aws.Time(now.Add(-2 * time.Minute)), Message: aws.String("(service deploying) was unable to place a task because no container instance met all of its requirements.")},
+				},
+			},
+		},
+		ContainerInstances: []*ecs.ContainerInstance{
+			{Ec2InstanceId: aws.String("i-1"), Status: aws.String("ACTIVE"), AgentConnected: aws.Bool(true),
+				VersionInfo:        &ecs.VersionInfo{AgentVersion: aws.String("1.68.2")},
+				RemainingResources: []*ecs.Resource{{Name: aws.String("CPU"), IntegerValue: aws.Int64(512)}, {Name: aws.String("MEMORY"), IntegerValue: aws.Int64(512)}}},
+			{Ec2InstanceId: aws.String("i-2"), Status: aws.String("ACTIVE"), AgentConnected: aws.Bool(false),
+				VersionInfo:        &ecs.VersionInfo{AgentVersion: aws.String("1.9.0")},
+				RemainingResources: []*ecs.Resource{{Name: aws.String("CPU"), IntegerValue: aws.Int64(0)}, {Name: aws.String("MEMORY"), IntegerValue: aws.Int64(512)}}},
+		},
+		StoppedTasks: []*ecs.Task{
+			{Group: aws.String("service:crashing"), Containers: []*ecs.Container{{ExitCode: aws.Int64(1)}}},
+			{Group: aws.String("service:crashing"), Containers: []*ecs.Container{{ExitCode: aws.Int64(137)}}},
+			{Group: aws.String("service:healthy"), Containers: []*ecs.Container{{ExitCode: aws.Int64(0)}}},
+			// Tasks replaced by a deployment are killed, and are not failures.
+			{Group: aws.String("service:deploying"), StopCode: aws.String("ServiceSchedulerInitiated"),
+				StoppedReason: aws.String("Scaling activity initiated by (deployment ecs-svc/1)"), Containers: []*ecs.Container{{ExitCode: aws.Int64(143)}}},
+			{Group: aws.String("service:deploying"), StopCode: aws.String("ServiceSchedulerInitiated"),
+				StoppedReason: aws.String("Scaling activity initiated by (deployment ecs-svc/1)"), Containers: []*ecs.Container{{ExitCode: aws.Int64(137)}}},
+			{Group: aws.String("service:deploying"), StoppedReason: aws.String("Scaling activity initiated by (deployment ecs-svc/1)"),
+				Containers: []*ecs.Container{{ExitCode: aws.Int64(137)}}},
+			{Group: aws.String("service:healthy"), StopCode: aws.String("UserInitiated"), Containers: []*ecs.Container{{ExitCode: aws.Int64(137)}}},
+			{Group: aws.String("service:healthy"), StopCode: aws.String("UserInitiated"), Containers: []*ecs.Container{{ExitCode: aws.Int64(137)}}},
+		},
+	}
+	findings := RunDoctor(state, DefaultDoctorOptions)
+	type key struct {
+		severity Severity
+		check    string
+		resource string
+	}
+	got := []key{}
+	for _, f := range findings {
+		got = append(got, key{f.Severity, f.Check, f.Resource})
+	}
+	expected := []key{
+		{SeverityCritical, "placement-failure", "deploying"},
+		{SeverityCritical, "instance-agent", "i-2"},
+		{SeverityCritical, "task-failures", "crashing"},
+		{SeverityWarning, "service-capacity", "deploying"},
+		{SeverityWarning, "stuck-deployment", "deploying"},
+		{SeverityWarning, "instance-agent", "i-2"},
+		{SeverityWarning, "instance-resources", "i-2"},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Finding %v: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+	assertTrue(t, HasCritical(findings))
+}
+
+func TestStoppedOnPurpose(t *testing.T) {
+	cases := []struct {
+		stopCode string
+		reason   string
+		expected bool
+	}{
+		{"ServiceSchedulerInitiated", "Scaling activity initiated by (deployment ecs-svc/1)", true},
+		{"UserInitiated", "Task stopped by user", true},
+		{"", "Scaling activity initiated by (deployment ecs-svc/1)", true},
+		{"ServiceSchedulerInitiated", "Task failed ELB health checks in (target-group arn:aws:elasticloadbalancing:us-west-2:1111:targetgroup/web/abc)", false},
+		{"EssentialContainerExited", "Essential container in task exited", false},
+	}
+	for _, c := range cases {
+		task := &ecs.Task{StopCode: aws.String(c.stopCode), StoppedReason: aws.String(c.reason)}
+		if got := stoppedOnPurpose(task); got != c.expected {
+			t.Errorf("%v %q: expected %v, got %v", c.stopCode, c.reason, c.expected, got)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assertTrue(t, compareVersions("1.68.2", "1.9.0") > 0)
+	assertTrue(t, compareVersions("1.9.0", "1.9") == 0)
+	assertTrue(t, compareVersions("", "1.0.0") < 0)
+}
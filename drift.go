@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ClusterRef identifies a cluster, optionally in a region other than the default one. On the
+// command line it is written as [region:]cluster.
+type ClusterRef struct {
+	Region  string
+	Cluster string
+}
+
+// ParseClusterRef parses a [region:]cluster string, or a cluster ARN. Cluster names cannot contain
+// colons, so the region prefix is unambiguous.
+func ParseClusterRef(s, defaultRegion string) (ClusterRef, error) {
+	if strings.HasPrefix(s, "arn:") {
+		arn := ecsq.ParseARN(s)
+		if arn.Type != "cluster" || arn.Region == "" || arn.Name == "" {
+			return ClusterRef{}, fmt.Errorf("%v is not a cluster ARN", s)
+		}
+		return ClusterRef{Region: arn.Region, Cluster: arn.Name}, nil
+	}
+	ref := ClusterRef{Region: defaultRegion, Cluster: s}
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		ref = ClusterRef{Region: s[:i], Cluster: s[i+1:]}
+	}
+	if ref.Region == "" || ref.Cluster == "" {
+		return ClusterRef{}, fmt.Errorf("%v is not a [region:]cluster", s)
+	}
+	return ref, nil
+}
+
+func (r ClusterRef) String() string {
+	return r.Region + ":" + r.Cluster
+}
+
+// ServiceConfig is the subset of a service's configuration that is compared for drift.
+type ServiceConfig struct {
+	Name                    string            `json:"name"`
+	FullName                string            `json:"fullName"`
+	DesiredCount            int64             `json:"desiredCount"`
+	TaskCPU                 string            `json:"taskCpu"`
+	TaskMemory              string            `json:"taskMemory"`
+	Images                  map[string]string `json:"images"`
+	ContainerCPU            map[string]int64  `json:"containerCpu"`
+	ContainerMemory         map[string]int64  `json:"containerMemory"`
+	DeploymentConfiguration string            `json:"deploymentConfiguration"`
+	LoadBalancerPorts       []string          `json:"loadBalancerPorts"`
+}
+
+// DriftEntry is a single difference between two clusters.
+type DriftEntry struct {
+	Service string `json:"service"`
+	Field   string `json:"field"`
+	A       string `json:"a"`
+	B       string `json:"b"`
+}
+
+// DriftReport is the result of comparing the services of two clusters.
+type DriftReport struct {
+	A           string       `json:"a"`
+	B           string       `json:"b"`
+	Differences []DriftEntry `json:"differences"`
+}
+
+// ImageTag returns the tag or digest of a container image, or "latest" if the image is untagged.
+func ImageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return "latest"
+}
+
+// NewServiceConfig extracts the comparable configuration from a service and its task definition.
+func NewServiceConfig(cluster string, service *ecs.Service, taskDefinition *ecs.TaskDefinition) *ServiceConfig {
+	config := &ServiceConfig{
+		Name:            ShortServiceName(cluster, *service.ServiceName),
+		FullName:        *service.ServiceName,
+		DesiredCount:    aws.Int64Value(service.DesiredCount),
+		Images:          map[string]string{},
+		ContainerCPU:    map[string]int64{},
+		ContainerMemory: map[string]int64{},
+	}
+	if taskDefinition != nil {
+		config.TaskCPU = aws.StringValue(taskDefinition.Cpu)
+		config.TaskMemory = aws.StringValue(taskDefinition.Memory)
+		for _, container := range taskDefinition.ContainerDefinitions {
+			name := aws.StringValue(container.Name)
+			config.Images[name] = ImageTag(aws.StringValue(container.Image))
+			config.ContainerCPU[name] = aws.Int64Value(container.Cpu)
+			config.ContainerMemory[name] = aws.Int64Value(container.Memory)
+		}
+	}
+	config.DeploymentConfiguration = formatDeploymentConfiguration(service.DeploymentConfiguration)
+	for _, lb := range service.LoadBalancers {
+		config.LoadBalancerPorts = append(config.LoadBalancerPorts,
+			fmt.Sprintf("%v:%v", aws.StringValue(lb.ContainerName), aws.Int64Value(lb.ContainerPort)))
+	}
+	sort.Strings(config.LoadBalancerPorts)
+	return config
+}
+
+func formatDeploymentConfiguration(c *ecs.DeploymentConfiguration) string {
+	if c == nil {
+		return ""
+	}
+	s := fmt.Sprintf("min=%v%% max=%v%%", aws.Int64Value(c.MinimumHealthyPercent), aws.Int64Value(c.MaximumPercent))
+	if cb := c.DeploymentCircuitBreaker; cb != nil && aws.BoolValue(cb.Enable) {
+		s += " circuit-breaker"
+		if aws.BoolValue(cb.Rollback) {
+			s += "+rollback"
+		}
+	}
+	return s
+}
+
+// CompareServiceConfigs returns the differences between two sets of services, matched by short
+// name. The result is sorted by service name.
+func CompareServiceConfigs(a, b []*ServiceConfig) []DriftEntry {
+	byName := func(configs []*ServiceConfig) map[string]*ServiceConfig {
+		m := map[string]*ServiceConfig{}
+		for _, c := range configs {
+			m[c.Name] = c
+		}
+		return m
+	}
+	aByName, bByName := byName(a), byName(b)
+	names := []string{}
+	for name := range aByName {
+		names = append(names, name)
+	}
+	for name := range bByName {
+		if _, ok := aByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entries := []DriftEntry{}
+	for _, name := range names {
+		sa, sb := aByName[name], bByName[name]
+		if sa == nil || sb == nil {
+			entry := DriftEntry{Service: name, Field: "Service", A: "present", B: "present"}
+			if sa == nil {
+				entry.A = "missing"
+			} else {
+				entry.B = "missing"
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		add := func(field, va, vb string) {
+			if va != vb {
+				entries = append(entries, DriftEntry{Service: name, Field: field, A: va, B: vb})
+			}
+		}
+		add("Desired Count", strconv.FormatInt(sa.DesiredCount, 10), strconv.FormatInt(sb.DesiredCount, 10))
+		add("Task CPU", sa.TaskCPU, sb.TaskCPU)
+		add("Task Memory", sa.TaskMemory, sb.TaskMemory)
+		for _, container := range containerNames(sa, sb) {
+			add("Image Tag ("+container+")", sa.Images[container], sb.Images[container])
+			add("CPU ("+container+")", formatResource(sa.ContainerCPU, container), formatResource(sb.ContainerCPU, container))
+			add("Memory ("+container+")", formatResource(sa.ContainerMemory, container), formatResource(sb.ContainerMemory, container))
+		}
+		add("Deployment Configuration", sa.DeploymentConfiguration, sb.DeploymentConfiguration)
+		add("Load Balancer Ports", strings.Join(sa.LoadBalancerPorts, ", "), strings.Join(sb.LoadBalancerPorts, ", "))
+	}
+	return entries
+}
+
+func containerNames(configs ...*ServiceConfig) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, c := range configs {
+		for name := range c.Images {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatResource(m map[string]int64, container string) string {
+	v, ok := m[container]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// getServiceConfigs describes every service in the cluster along with its task definition.
+func getServiceConfigs(ctx context.Context, svc *ecs.ECS, cluster string) ([]*ServiceConfig, error) {
+	services, err := listServices(ctx, svc, cluster, nil)
+	if err != nil {
+		return nil, err
+	}
+	arns := []string{}
+	for _, service := range services.Services {
+		arns = append(arns, aws.StringValue(service.TaskDefinition))
+	}
+	taskDefinitions, err := getTaskDefinitions(ctx, svc, arns)
+	if err != nil {
+		return nil, err
+	}
+	configs := []*ServiceConfig{}
+	for _, service := range services.Services {
+		configs = append(configs, NewServiceConfig(cluster, service, taskDefinitions[aws.StringValue(service.TaskDefinition)]))
+	}
+	return configs, nil
+}
+
+// RenderDriftReport writes the report in the given format, either table or json.
+func RenderDriftReport(w io.Writer, report *DriftReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	if len(report.Differences) == 0 {
+		fmt.Fprintf(w, "No differences between %v and %v\n", report.A, report.B)
+		return nil
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Service", "Field", report.A, report.B})
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, d := range report.Differences {
+		table.Append([]string{d.Service, d.Field, d.A, d.B})
+	}
+	table.Render()
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShortServiceName(t *testing.T) {
+	t.Setenv("ECSQ_SERVICE_NAME_EXPANSION", "service-{{.Name}}-{{.Cluster}}")
+	if got := ShortServiceName("ecs-prod", "service-applepicker-ecs-prod"); got != "applepicker" {
+		t.Errorf("Expected applepicker, got %v", got)
+	}
+	if got := ShortServiceName("ecs-prod", "service-applepicker-ecs-staging"); got != "service-applepicker-ecs-staging" {
+		t.Errorf("Expected name to be unchanged, got %v", got)
+	}
+	if got, err := FormatServiceName("ecs-prod", ShortServiceName("ecs-prod", "service-applepicker-ecs-prod")); err != nil || got != "service-applepicker-ecs-prod" {
+		t.Errorf("Expected round trip, got %v", got)
+	}
+}
+
+func TestParseClusterRef(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected ClusterRef
+		err      bool
+	}{
+		{"ecs-prod", ClusterRef{Region: "us-west-2", Cluster: "ecs-prod"}, false},
+		{"us-east-1:ecs-prod", ClusterRef{Region: "us-east-1", Cluster: "ecs-prod"}, false},
+		{"arn:aws:ecs:us-east-1:123456789012:cluster/ecs-prod", ClusterRef{Region: "us-east-1", Cluster: "ecs-prod"}, false},
+		{"arn:aws-cn:ecs:cn-north-1:123456789012:cluster/ecs-prod", ClusterRef{Region: "cn-north-1", Cluster: "ecs-prod"}, false},
+		{"arn:aws:ecs:us-east-1:123456789012:service/ecs-prod/applepicker", ClusterRef{}, true},
+		{"arn:aws:ecs:us-east-1", ClusterRef{}, true},
+		{"us-east-1:", ClusterRef{}, true},
+		{":ecs-prod", ClusterRef{}, true},
+	}
+	for _, c := range cases {
+		ref, err := ParseClusterRef(c.input, "us-west-2")
+		if (err != nil) != c.err {
+			t.Errorf("ParseClusterRef(%q): unexpected error %v", c.input, err)
+		}
+		if ref != c.expected {
+			t.Errorf("ParseClusterRef(%q) = %+v, expected %+v", c.input, ref, c.expected)
+		}
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	cases := map[string]string{
+		"nginx":                "latest",
+		"nginx:1.23":           "1.23",
+		"localhost:5000/nginx": "latest",
+		"123.dkr.ecr.us-east-1.amazonaws.com/app:abc123": "abc123",
+		"app@sha256:deadbeef":                            "sha256:deadbeef",
+	}
+	for image, expected := range cases {
+		if got := ImageTag(image); got != expected {
+			t.Errorf("ImageTag(%v): expected %v, got %v", image, expected, got)
+		}
+	}
+}
+
+func TestCompareServiceConfigs(t *testing.T) {
+	a := []*ServiceConfig{
+		{Name: "web", DesiredCount: 3, Images: map[string]string{"web": "v2"}, ContainerCPU: map[string]int64{"web": 256}},
+		{Name: "worker", DesiredCount: 1},
+	}
+	b := []*ServiceConfig{
+		{Name: "web", DesiredCount: 2, Images: map[string]string{"web": "v1"}, ContainerCPU: map[string]int64{"web": 256}},
+		{Name: "cron", DesiredCount: 1},
+	}
+	expected := []DriftEntry{
+		{Service: "cron", Field: "Service", A: "missing", B: "present"},
+		{Service: "web", Field: "Desired Count", A: "3", B: "2"},
+		{Service: "web", Field: "Image Tag (web)", A: "v2", B: "v1"},
+		{Service: "worker", Field: "Service", A: "present", B: "missing"},
+	}
+	if got := CompareServiceConfigs(a, b); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
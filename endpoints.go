@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// EndpointService is a service whose endpoint can be overridden, to run ecsq against LocalStack or
+// a mock server.
+type EndpointService struct {
+	// Name is what the service is called in --endpoint-url.
+	Name string
+	// EndpointsID is the SDK's ID for the service when resolving endpoints.
+	EndpointsID string
+	// ServiceID is the AWS service ID, which names the service in AWS_ENDPOINT_URL_<SERVICE> and in
+	// the services sections of ~/.aws/config.
+	ServiceID string
+}
+
+// EnvName returns the environment variable that sets the service's endpoint.
+func (s EndpointService) EnvName() string {
+	return "AWS_ENDPOINT_URL_" + strings.ToUpper(s.ServiceID)
+}
+
+// ConfigKey returns the key of the service in a services section of ~/.aws/config.
+func (s EndpointService) ConfigKey() string {
+	return strings.ToLower(s.ServiceID)
+}
+
+// EndpointServices are the services ecsq calls, or may call.
+var EndpointServices = []EndpointService{
+	{Name: "ecs", EndpointsID: ecs.EndpointsID, ServiceID: "ECS"},
+	{Name: "ec2", EndpointsID: ec2.EndpointsID, ServiceID: "EC2"},
+	{Name: "logs", EndpointsID: "logs", ServiceID: "CloudWatch_Logs"},
+	{Name: "ssm", EndpointsID: "ssm", ServiceID: "SSM"},
+	{Name: "elbv2", EndpointsID: elbv2.EndpointsID, ServiceID: "Elastic_Load_Balancing_v2"},
+	{Name: "sts", EndpointsID: sts.EndpointsID, ServiceID: "STS"},
+	{Name: "cloudwatch", EndpointsID: cloudwatch.EndpointsID, ServiceID: "CloudWatch"},
+	{Name: "autoscaling", EndpointsID: applicationautoscaling.EndpointsID, ServiceID: "Application_Auto_Scaling"},
+	{Name: "servicediscovery", EndpointsID: servicediscovery.EndpointsID, ServiceID: "ServiceDiscovery"},
+}
+
+// EndpointServiceNames returns the names --endpoint-url accepts.
+func EndpointServiceNames() []string {
+	names := []string{}
+	for _, s := range EndpointServices {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Endpoints are endpoint URLs from one source, such as the command line or the environment.
+type Endpoints struct {
+	// All is the endpoint of every service without one of its own.
+	All string
+	// Services maps service names to their endpoints.
+	Services map[string]string
+}
+
+// URL returns the endpoint for the named service, or "" if the source does not set one.
+func (e Endpoints) URL(service string) string {
+	if u := e.Services[service]; u != "" {
+		return u
+	}
+	return e.All
+}
+
+// ParseEndpointURLs parses --endpoint-url values. Each is either <service>=<url>, or a URL for
+// every service.
+func ParseEndpointURLs(values []string) (Endpoints, error) {
+	e := Endpoints{Services: map[string]string{}}
+	for _, value := range values {
+		service, u, ok := strings.Cut(value, "=")
+		if !ok || strings.Contains(service, "/") {
+			if err := validateEndpointURL(value); err != nil {
+				return Endpoints{}, err
+			}
+			e.All = value
+			continue
+		}
+		if !isEndpointService(service) {
+			return Endpoints{}, fmt.Errorf("unknown service %q, the options are %v", service, strings.Join(EndpointServiceNames(), ", "))
+		}
+		if err := validateEndpointURL(u); err != nil {
+			return Endpoints{}, err
+		}
+		e.Services[service] = u
+	}
+	return e, nil
+}
+
+func isEndpointService(name string) bool {
+	for _, s := range EndpointServices {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateEndpointURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("endpoint %q is not an http or https URL", value)
+	}
+	return nil
+}
+
+// EnvEndpoints reads endpoints from AWS_ENDPOINT_URL and AWS_ENDPOINT_URL_<SERVICE>, such as
+// AWS_ENDPOINT_URL_ECS.
+func EnvEndpoints(getenv func(string) string) Endpoints {
+	e := Endpoints{All: getenv("AWS_ENDPOINT_URL"), Services: map[string]string{}}
+	for _, s := range EndpointServices {
+		if u := getenv(s.EnvName()); u != "" {
+			e.Services[s.Name] = u
+		}
+	}
+	return e
+}
+
+// ConfigFileEndpoints reads the endpoints of a profile from an AWS config file: the profile's
+// endpoint_url, and the endpoint_url of each service in the services section it names. A missing
+// file sets no endpoints.
+//
+//	[profile localstack]
+//	endpoint_url = http://localhost:4566
+//	services = localstack
+//
+//	[services localstack]
+//	ecs =
+//	  endpoint_url = http://localhost:4567
+func ConfigFileEndpoints(path, profile string) (Endpoints, error) {
+	e := Endpoints{Services: map[string]string{}}
+	sections, err := readAWSConfigFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return e, nil
+	} else if err != nil {
+		return e, err
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		if _, ok := sections[section]; !ok {
+			section = "default"
+		}
+	}
+	e.All = sections[section]["endpoint_url"]
+	if services := sections[section]["services"]; services != "" {
+		for _, s := range EndpointServices {
+			if u := sections["services "+services][s.ConfigKey()+".endpoint_url"]; u != "" {
+				e.Services[s.Name] = u
+			}
+		}
+	}
+	return e, nil
+}
+
+// readAWSConfigFile reads the sections of an AWS config file. Nested properties, which are
+// indented under a key with no value, are keyed as <key>.<property>.
+func readAWSConfigFile(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	parent := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.Join(strings.Fields(trimmed[1:len(trimmed)-1]), " ")
+			section = map[string]string{}
+			sections[name] = section
+			parent = ""
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, "=")
+		if !ok || section == nil {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		nested := line[0] == ' ' || line[0] == '\t'
+		switch {
+		case nested && parent != "":
+			section[parent+"."+key] = value
+		case value == "":
+			parent = key
+		default:
+			section[key] = value
+			parent = ""
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// DefaultAWSConfigFile returns the path of the AWS config file, which AWS_CONFIG_FILE overrides.
+func DefaultAWSConfigFile() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "config")
+}
+
+// awsProfileName returns the profile the SDK uses: the --profile flag, or else AWS_PROFILE or
+// AWS_DEFAULT_PROFILE.
+func awsProfileName(flag string) string {
+	for _, profile := range []string{flag, os.Getenv("AWS_PROFILE"), os.Getenv("AWS_DEFAULT_PROFILE")} {
+		if profile != "" {
+			return profile
+		}
+	}
+	return "default"
+}
+
+// NewEndpointResolver returns a resolver that uses the first endpoint set for a service by the
+// given sources, in order, and the AWS endpoint otherwise. Within a source, an endpoint for the
+// service takes precedence over one for every service.
+func NewEndpointResolver(sources ...Endpoints) endpoints.Resolver {
+	urls := map[string]string{}
+	for _, s := range EndpointServices {
+		for _, source := range sources {
+			if u := source.URL(s.Name); u != "" {
+				urls[s.EndpointsID] = u
+				break
+			}
+		}
+	}
+	return endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if u, ok := urls[service]; ok {
+			return endpoints.ResolvedEndpoint{URL: u, SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+}
+
+// NewTransport returns the transport AWS requests are made with. If insecure is set, TLS
+// certificates are not verified, for stand-ins with self-signed certificates.
+func NewTransport(insecure bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEndpointURLs(t *testing.T) {
+	e, err := ParseEndpointURLs([]string{"http://localhost:4566", "ecs=http://localhost:4567"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.URL("ecs"); got != "http://localhost:4567" {
+		t.Errorf("ecs: got %v", got)
+	}
+	if got := e.URL("ec2"); got != "http://localhost:4566" {
+		t.Errorf("ec2: got %v", got)
+	}
+
+	for _, value := range []string{"rds=http://localhost:4566", "ecs=localhost:4566", "localhost"} {
+		if _, err := ParseEndpointURLs([]string{value}); err == nil {
+			t.Errorf("%v: expected an error", value)
+		}
+	}
+}
+
+func TestEnvEndpoints(t *testing.T) {
+	env := map[string]string{
+		"AWS_ENDPOINT_URL":                           "http://localhost:4566",
+		"AWS_ENDPOINT_URL_ELASTIC_LOAD_BALANCING_V2": "http://localhost:4568",
+	}
+	e := EnvEndpoints(func(key string) string { return env[key] })
+	if got := e.URL("elbv2"); got != "http://localhost:4568" {
+		t.Errorf("elbv2: got %v", got)
+	}
+	if got := e.URL("logs"); got != "http://localhost:4566" {
+		t.Errorf("logs: got %v", got)
+	}
+}
+
+func TestConfigFileEndpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte(`
+[default]
+region = us-west-2
+
+[profile localstack]
+region = us-east-1
+endpoint_url = http://localhost:4566
+services = local
+
+[services local]
+# ECS runs on its own port
+ecs =
+  endpoint_url = http://localhost:4567
+cloudwatch_logs =
+  endpoint_url = http://localhost:4569
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := ConfigFileEndpoints(path, "localstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"ecs":  "http://localhost:4567",
+		"logs": "http://localhost:4569",
+		"ec2":  "http://localhost:4566",
+	}
+	for service, url := range expected {
+		if got := e.URL(service); got != url {
+			t.Errorf("%v: expected %v, got %v", service, url, got)
+		}
+	}
+
+	e, err = ConfigFileEndpoints(path, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, e.URL("ecs") == "")
+
+	_, err = ConfigFileEndpoints(filepath.Join(t.TempDir(), "missing"), "default")
+	assertTrue(t, err == nil)
+}
+
+func TestEndpointResolver(t *testing.T) {
+	flags := Endpoints{Services: map[string]string{"ecs": "http://localhost:1"}}
+	env := Endpoints{All: "http://localhost:2", Services: map[string]string{"sts": "http://localhost:3"}}
+	resolver := NewEndpointResolver(flags, env, Endpoints{All: "http://localhost:4"})
+
+	expected := map[string]string{
+		"ecs":                     "http://localhost:1",
+		"sts":                     "http://localhost:3",
+		"ec2":                     "http://localhost:2",
+		"application-autoscaling": "http://localhost:2",
+	}
+	for service, url := range expected {
+		resolved, err := resolver.EndpointFor(service, "us-west-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved.URL != url || resolved.SigningRegion != "us-west-2" {
+			t.Errorf("%v: expected %v, got %+v", service, url, resolved)
+		}
+	}
+
+	resolved, err := NewEndpointResolver().EndpointFor("ecs", "us-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, resolved.URL == "https://ecs.us-west-2.amazonaws.com")
+}
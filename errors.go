@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+)
+
+// ErrorKind classifies why a command failed. Each kind has its own exit code.
+type ErrorKind string
+
+// The kinds of errors, and their exit codes. ExitFindings is not an error, so it has no kind.
+const (
+	KindError          ErrorKind = "error"           // 1
+	KindInvalidInput   ErrorKind = "invalid_input"   // 2
+	KindNotFound       ErrorKind = "not_found"       // 3
+	KindAccessDenied   ErrorKind = "access_denied"   // 4
+	KindThrottled      ErrorKind = "throttled"       // 5
+	KindPartialFailure ErrorKind = "partial_failure" // 6
+	KindTimeout        ErrorKind = "timeout"         // 124, like timeout(1)
+	KindInterrupted    ErrorKind = "interrupted"     // 130, like a shell after Ctrl-C
+)
+
+// ExitFindings is the exit code of doctor, lint and drift when they find a critical problem or a
+// difference, kept apart from the error codes so scripts can tell the two apart.
+const ExitFindings = 10
+
+var exitCodes = map[ErrorKind]int{
+	KindError:          1,
+	KindInvalidInput:   2,
+	KindNotFound:       3,
+	KindAccessDenied:   4,
+	KindThrottled:      5,
+	KindPartialFailure: 6,
+	KindTimeout:        124,
+	KindInterrupted:    130,
+}
+
+// ExitCode returns the exit status ecsq exits with for this kind of error.
+func (k ErrorKind) ExitCode() int {
+	if code, ok := exitCodes[k]; ok {
+		return code
+	}
+	return 1
+}
+
+// AWS error codes that mean the same thing across services.
+var (
+	accessDeniedCodes = map[string]bool{
+		"AccessDenied":                true,
+		"AccessDeniedException":       true,
+		"UnauthorizedOperation":       true,
+		"UnrecognizedClientException": true,
+		"InvalidClientTokenId":        true,
+		"ExpiredToken":                true,
+		"ExpiredTokenException":       true,
+		"NoCredentialProviders":       true,
+		"SignatureDoesNotMatch":       true,
+		"AuthFailure":                 true,
+	}
+	notFoundCodes = map[string]bool{
+		"ClusterNotFoundException":   true,
+		"ServiceNotFoundException":   true,
+		"ServiceNotActiveException":  true,
+		"TargetNotFoundException":    true,
+		"ResourceNotFoundException":  true,
+		"TargetGroupNotFound":        true,
+		"LoadBalancerNotFound":       true,
+		"InvalidInstanceID.NotFound": true,
+	}
+	invalidInputCodes = map[string]bool{
+		"InvalidParameterException":   true,
+		"InvalidParameterValue":       true,
+		"InvalidParameterCombination": true,
+		"ValidationError":             true,
+		"ValidationException":         true,
+		"InvalidInput":                true,
+		"InvalidRequestException":     true,
+	}
+)
+
+// CommandError is an error a command fails with. It says what the command was doing and why it
+// failed, and maps to an exit code.
+type CommandError struct {
+	Kind ErrorKind
+	// Message says what failed, such as "Could not list services".
+	Message string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns an error of the given kind, for failures that have no underlying error.
+func NewError(kind ErrorKind, format string, args ...interface{}) error {
+	return &CommandError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError says what the command was doing when err happened, and classifies it. It returns nil
+// if err is nil.
+func WrapError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &CommandError{Kind: ClassifyError(err), Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// InvalidInputError is WrapError for errors in the command's arguments and flags.
+func InvalidInputError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &CommandError{Kind: KindInvalidInput, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// FailuresError is the error for the failures of a bulk Describe call, which the command has
+// already printed. It returns nil if there are none.
+func FailuresError(failures []*ecs.Failure, resources string) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return &CommandError{
+		Kind:    KindPartialFailure,
+		Message: fmt.Sprintf("Could not describe %v %v", len(failures), resources),
+		Err:     ecsq.NewFailureError(failures[0]),
+	}
+}
+
+// InterruptedError is the error of a command that stopped early because of Ctrl-C or --timeout.
+func InterruptedError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return NewError(KindTimeout, "Timed out")
+	}
+	return NewError(KindInterrupted, "Interrupted")
+}
+
+// SkipSection warns that an optional section of a command's output is left out because it could
+// not be described, for example because the credentials lack permission for another AWS service,
+// so the rest of the output is still shown. If the command was interrupted, it returns the error to
+// stop the command with instead.
+func SkipSection(ctx context.Context, w io.Writer, section string, err error) error {
+	if ctx.Err() != nil {
+		return InterruptedError(ctx)
+	}
+	fmt.Fprintf(w, "Could not describe %v, leaving them out: %v\n", section, err)
+	return nil
+}
+
+// ClassifyError works out the kind of an error from the ecsq library, the AWS SDK or the context.
+func ClassifyError(err error) ErrorKind {
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) && commandErr.Kind != "" {
+		return commandErr.Kind
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindInterrupted
+	case errors.Is(err, ecsq.ErrNotFound), errors.Is(err, ecsq.ErrNoTasks):
+		return KindNotFound
+	case errors.Is(err, ecsq.ErrInvalidServiceNameExpansion):
+		return KindInvalidInput
+	}
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return KindError
+	}
+	switch code := awsErr.Code(); {
+	case code == request.CanceledErrorCode:
+		// The SDK does not wrap the context's error, so look for it in the original error.
+		if errors.Is(awsErr.OrigErr(), context.DeadlineExceeded) {
+			return KindTimeout
+		}
+		return KindInterrupted
+	case request.IsErrorThrottle(err):
+		return KindThrottled
+	case accessDeniedCodes[code]:
+		return KindAccessDenied
+	case notFoundCodes[code]:
+		return KindNotFound
+	case invalidInputCodes[code]:
+		return KindInvalidInput
+	}
+	return KindError
+}
+
+// ErrorEnvelope is how errors are written with --output json, so scripts can tell them from
+// results.
+type ErrorEnvelope struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error in the envelope.
+type ErrorDetail struct {
+	Kind     ErrorKind `json:"kind"`
+	Message  string    `json:"message"`
+	ExitCode int       `json:"exit_code"`
+	// AWSCode and RequestID are set if an AWS API call failed.
+	AWSCode   string `json:"aws_code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewErrorDetail describes err for the error envelope.
+func NewErrorDetail(err error) ErrorDetail {
+	kind := ClassifyError(err)
+	detail := ErrorDetail{Kind: kind, Message: err.Error(), ExitCode: kind.ExitCode()}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		detail.AWSCode = awsErr.Code()
+	}
+	var requestErr awserr.RequestFailure
+	if errors.As(err, &requestErr) {
+		detail.RequestID = requestErr.RequestID()
+	}
+	return detail
+}
+
+// ReportError writes the error, as an ErrorEnvelope if asJSON is set, and returns the exit code
+// for it.
+func ReportError(w io.Writer, err error, asJSON bool) int {
+	detail := NewErrorDetail(err)
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(ErrorEnvelope{Error: detail})
+	} else {
+		fmt.Fprintf(w, "ecsq: error: %v\n", err)
+	}
+	return detail.ExitCode
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+)
+
+func TestClassifyError(t *testing.T) {
+	missing := ecsq.NewFailureError(&ecs.Failure{Arn: aws.String("arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/abc"), Reason: aws.String("MISSING")})
+	for err, kind := range map[error]ErrorKind{
+		errors.New("boom"): KindError,
+		missing:            KindNotFound,
+		context.Canceled:   KindInterrupted,
+		ecsq.ErrNoTasks:    KindNotFound,
+		fmt.Errorf("listing: %w", context.DeadlineExceeded):                                              KindTimeout,
+		awserr.New("AccessDeniedException", "not authorized to perform ecs:ListServices", nil):           KindAccessDenied,
+		awserr.New("ThrottlingException", "Rate exceeded", nil):                                          KindThrottled,
+		awserr.New("ClusterNotFoundException", "Cluster not found.", nil):                                KindNotFound,
+		awserr.New("InvalidParameterException", "Invalid identifier", nil):                               KindInvalidInput,
+		awserr.New(request.CanceledErrorCode, "request context canceled", context.DeadlineExceeded):      KindTimeout,
+		NewError(KindInvalidInput, "Invalid --sort"):                                                     KindInvalidInput,
+		FailuresError([]*ecs.Failure{{Arn: aws.String("a"), Reason: aws.String("MISSING")}}, "services"): KindPartialFailure,
+	} {
+		assertTrue(t, ClassifyError(WrapError(err, "Could not list services")) == kind)
+	}
+	assertTrue(t, WrapError(nil, "Could not list services") == nil)
+	assertTrue(t, FailuresError(nil, "services") == nil)
+}
+
+func TestReportError(t *testing.T) {
+	err := WrapError(awserr.NewRequestFailure(awserr.New("ClusterNotFoundException", "Cluster not found.", nil), 400, "req-123"), "Could not list services")
+
+	var out bytes.Buffer
+	assertTrue(t, ReportError(&out, err, false) == 3)
+	assertTrue(t, out.String() == "ecsq: error: Could not list services: ClusterNotFoundException: Cluster not found.\n\tstatus code: 400, request id: req-123\n")
+
+	out.Reset()
+	assertTrue(t, ReportError(&out, err, true) == 3)
+	var envelope ErrorEnvelope
+	assertTrue(t, json.Unmarshal(out.Bytes(), &envelope) == nil)
+	assertTrue(t, envelope.Error.Kind == KindNotFound)
+	assertTrue(t, envelope.Error.ExitCode == 3)
+	assertTrue(t, envelope.Error.AWSCode == "ClusterNotFoundException")
+	assertTrue(t, envelope.Error.RequestID == "req-123")
+}
+
+func TestSkipSection(t *testing.T) {
+	denied := awserr.New("AccessDeniedException", "not authorized to perform elasticloadbalancing:DescribeTargetGroups", nil)
+	var out bytes.Buffer
+	assertTrue(t, SkipSection(context.Background(), &out, "load balancers", denied) == nil)
+	assertTrue(t, out.String() == "Could not describe load balancers, leaving them out: AccessDeniedException: not authorized to perform elasticloadbalancing:DescribeTargetGroups\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out.Reset()
+	assertTrue(t, ClassifyError(SkipSection(ctx, &out, "load balancers", denied)) == KindInterrupted)
+	assertTrue(t, out.Len() == 0)
+}
+
+func TestInvalidServiceNameExpansionExitCode(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	t.Setenv("ECSQ_SERVICE_NAME_EXPANSION", "service-{{.Name")
+	var code int
+	_, stderr := captureOutput(t, func() {
+		code = run([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "tasks", "ecs-prod", "applepicker"})
+	})
+	assertTrue(t, code == KindInvalidInput.ExitCode())
+	assertTrue(t, strings.Contains(stderr, "Invalid ECSQ_SERVICE_NAME_EXPANSION"))
+}
+
+func TestErrorFormat(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	ecsq := func(args ...string) (int, string, string) {
+		var code int
+		stdout, stderr := captureOutput(t, func() {
+			code = run(append([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache"}, args...))
+		})
+		return code, stdout, stderr
+	}
+
+	// The --output of a command does not decide the format of errors.
+	code, stdout, stderr := ecsq("tasks", "ecs-prod", "applepicker", "--bogus", "-o", "json")
+	assertTrue(t, code == KindInvalidInput.ExitCode())
+	assertTrue(t, stdout == "")
+	assertTrue(t, strings.HasPrefix(stderr, "ecsq: error: "))
+
+	code, stdout, _ = ecsq("--error-format", "json", "tasks", "ecs-prod", "applepicker", "--bogus")
+	var envelope ErrorEnvelope
+	assertTrue(t, json.Unmarshal([]byte(stdout), &envelope) == nil)
+	assertTrue(t, envelope.Error.Kind == KindInvalidInput && envelope.Error.ExitCode == code)
+
+	t.Setenv("ECSQ_ERROR_FORMAT", "json")
+	_, stdout, _ = ecsq("tasks", "ecs-prod", "applepicker", "--bogus")
+	assertTrue(t, json.Unmarshal([]byte(stdout), &envelope) == nil)
+}
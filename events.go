@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// EventFilter selects service events for the cluster-wide timeline.
+type EventFilter struct {
+	// Since and Until bound the event times. Zero values leave the range open.
+	Since time.Time
+	Until time.Time
+	// Grep, if set, must match the event message.
+	Grep *regexp.Regexp
+	// Services are name prefixes, matched against the full or short service name. If empty, every
+	// service matches.
+	Services []string
+}
+
+// MatchesService returns whether the service name starts with one of the filter's prefixes.
+func (f EventFilter) MatchesService(cluster, service string) bool {
+	if len(f.Services) == 0 {
+		return true
+	}
+	short := ShortServiceName(cluster, service)
+	for _, prefix := range f.Services {
+		if strings.HasPrefix(service, prefix) || strings.HasPrefix(short, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether the event is within the time range and matches the pattern.
+func (f EventFilter) Matches(e *ecs.ServiceEvent) bool {
+	t := aws.TimeValue(e.CreatedAt)
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && t.After(f.Until) {
+		return false
+	}
+	return f.Grep == nil || f.Grep.MatchString(aws.StringValue(e.Message))
+}
+
+// ClusterEvent is a service event in the cluster-wide timeline. Repeated events are grouped into
+// one, with the time of the last repetition.
+type ClusterEvent struct {
+	ID      string
+	Time    time.Time
+	Service string
+	Message string
+	Count   int
+	Last    time.Time
+}
+
+// MergeServiceEvents collects the events of every service that match the filter into one
+// timeline, oldest first.
+func MergeServiceEvents(cluster string, services []*ecs.Service, filter EventFilter) []*ClusterEvent {
+	events := []*ClusterEvent{}
+	for _, s := range services {
+		name := aws.StringValue(s.ServiceName)
+		if !filter.MatchesService(cluster, name) {
+			continue
+		}
+		for _, e := range s.Events {
+			if !filter.Matches(e) {
+				continue
+			}
+			events = append(events, &ClusterEvent{
+				ID:      aws.StringValue(e.Id),
+				Time:    aws.TimeValue(e.CreatedAt),
+				Service: ShortServiceName(cluster, name),
+				Message: aws.StringValue(e.Message),
+				Count:   1,
+				Last:    aws.TimeValue(e.CreatedAt),
+			})
+		}
+	}
+	MustParseSort("time,service", ClusterEventSortKeys).Sort(events)
+	return events
+}
+
+// ClusterEventSortKeys are the keys the cluster-wide timeline is sorted by.
+var ClusterEventSortKeys = []SortKey[*ClusterEvent]{
+	TimeKey("time", func(e *ClusterEvent) *time.Time { return &e.Time }),
+	StringKey("service", func(e *ClusterEvent) string { return e.Service }),
+}
+
+// GroupRepeatedEvents folds runs of the same message from the same service, such as "has reached
+// a steady state", into the first event of the run. Events from other services in between do not
+// break a run.
+func GroupRepeatedEvents(events []*ClusterEvent) []*ClusterEvent {
+	grouped := []*ClusterEvent{}
+	last := map[string]*ClusterEvent{}
+	for _, e := range events {
+		if prev, ok := last[e.Service]; ok && stripServiceName(prev.Message) == stripServiceName(e.Message) {
+			prev.Count += e.Count
+			prev.Last = e.Last
+			continue
+		}
+		grouped = append(grouped, e)
+		last[e.Service] = e
+	}
+	return grouped
+}
+
+var eventServicePrefix = regexp.MustCompile(`^\(service [^)]*\) `)
+
+// stripServiceName removes the "(service <name>)" prefix ECS puts in front of event messages.
+func stripServiceName(message string) string {
+	return eventServicePrefix.ReplaceAllString(message, "")
+}
+
+// RenderClusterEvents writes the events one per line.
+func RenderClusterEvents(w io.Writer, events []*ClusterEvent) {
+	for _, e := range events {
+		line := fmt.Sprintf("%v %v: %v", e.Time.Format(time.RFC3339), e.Service, stripServiceName(e.Message))
+		if e.Count > 1 {
+			line += fmt.Sprintf(" (%v times, last at %v)", e.Count, e.Last.Format(time.RFC3339))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// ParseEventTime parses a --since or --until value, either a duration before now such as 2h, or
+// an RFC 3339 time. An empty value returns the zero time.
+func ParseEventTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration like 2h nor a time like 2006-01-02T15:04:05Z", s)
+	}
+	return t, nil
+}
+
+// MinFollowInterval is the shortest interval --follow polls at, so it does not hammer DescribeServices.
+const MinFollowInterval = time.Second
+
+// FollowServiceEvents prints the timeline, then polls the services every interval and prints
+// events it has not printed before. It returns on error, once the context is done, or after the
+// first poll at or after filter.Until, if set.
+func FollowServiceEvents(ctx context.Context, w io.Writer, svc *ecs.ECS, cluster string, filter EventFilter, group bool, interval time.Duration) error {
+	seen := map[string]bool{}
+	for {
+		services, err := listServices(ctx, svc, cluster, nil)
+		if err != nil {
+			return err
+		}
+		events := []*ClusterEvent{}
+		for _, e := range MergeServiceEvents(cluster, services.Services, filter) {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				events = append(events, e)
+			}
+		}
+		if group {
+			events = GroupRepeatedEvents(events)
+		}
+		RenderClusterEvents(w, events)
+		wait := interval
+		if !filter.Until.IsZero() {
+			remaining := time.Until(filter.Until)
+			if remaining <= 0 {
+				return nil
+			}
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestMergeServiceEvents(t *testing.T) {
+	base := time.Date(2017, 8, 15, 18, 0, 0, 0, time.UTC)
+	event := func(id string, minutes int, message string) *ecs.ServiceEvent {
+		return &ecs.ServiceEvent{Id: aws.String(id), CreatedAt: aws.Time(base.Add(time.Duration(minutes) * time.Minute)), Message: aws.String(message)}
+	}
+	services := []*ecs.Service{
+		{ServiceName: aws.String("applepicker"), Events: []*ecs.ServiceEvent{
+			event("a4", 40, "(service applepicker) has reached a steady state."),
+			event("a3", 30, "(service applepicker) has reached a steady state."),
+			event("a2", 20, "(service applepicker) has stopped 1 running tasks."),
+			event("a1", 0, "(service applepicker) has reached a steady state."),
+		}},
+		{ServiceName: aws.String("bananaboat"), Events: []*ecs.ServiceEvent{
+			event("b2", 35, "(service bananaboat) has reached a steady state."),
+			event("b1", 25, "(service bananaboat) was unable to place a task."),
+		}},
+	}
+
+	events := MergeServiceEvents("ecs-prod", services, EventFilter{})
+	ids := ""
+	for _, e := range events {
+		ids += e.ID + " "
+	}
+	assertTrue(t, ids == "a1 a2 b1 a3 b2 a4 ")
+
+	grouped := GroupRepeatedEvents(events)
+	assertTrue(t, len(grouped) == 5)
+	assertTrue(t, grouped[3].ID == "a3" && grouped[3].Count == 2 && grouped[3].Last.Equal(base.Add(40*time.Minute)))
+
+	var out bytes.Buffer
+	RenderClusterEvents(&out, grouped[3:4])
+	assertTrue(t, out.String() == "2017-08-15T18:30:00Z applepicker: has reached a steady state. (2 times, last at 2017-08-15T18:40:00Z)\n")
+
+	filtered := MergeServiceEvents("ecs-prod", services, EventFilter{
+		Since:    base.Add(10 * time.Minute),
+		Until:    base.Add(30 * time.Minute),
+		Grep:     regexp.MustCompile("stopped|unable"),
+		Services: []string{"apple", "banana"},
+	})
+	assertTrue(t, len(filtered) == 2 && filtered[0].ID == "a2" && filtered[1].ID == "b1")
+	assertTrue(t, len(MergeServiceEvents("ecs-prod", services, EventFilter{Services: []string{"cherry"}})) == 0)
+}
+
+func TestParseEventTime(t *testing.T) {
+	now := time.Date(2017, 8, 15, 18, 0, 0, 0, time.UTC)
+	since, err := ParseEventTime("2h", now)
+	assertTrue(t, err == nil && since.Equal(now.Add(-2*time.Hour)))
+	since, err = ParseEventTime("2017-08-15T12:00:00Z", now)
+	assertTrue(t, err == nil && since.Equal(now.Add(-6*time.Hour)))
+	since, err = ParseEventTime("", now)
+	assertTrue(t, err == nil && since.IsZero())
+	_, err = ParseEventTime("yesterday", now)
+	assertTrue(t, err != nil)
+}
+
+func TestEventsFollowFlags(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	events := func(args ...string) (int, string) {
+		var code int
+		_, stderr := captureOutput(t, func() {
+			code = run(append([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--timeout", "10s", "events", "ecs-prod", "--follow"}, args...))
+		})
+		return code, stderr
+	}
+
+	for _, interval := range []string{"0s", "-1s", "500ms"} {
+		code, stderr := events("--interval=" + interval)
+		assertTrue(t, code == 2)
+		assertTrue(t, strings.Contains(stderr, "Invalid --interval"))
+	}
+
+	// Following stops after the first poll once --until has passed, rather than at --timeout.
+	start := time.Now()
+	code, _ := events("--until", "1m")
+	assertTrue(t, code == 0)
+	assertTrue(t, time.Since(start) < 5*time.Second)
+
+	start = time.Now()
+	code, _ = events("--interval", "1s", "--until", start.Add(1500*time.Millisecond).Format(time.RFC3339Nano))
+	assertTrue(t, code == 0)
+	assertTrue(t, time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+)
+
+// SessionPlugin hands an ECS Exec session to a program that connects the terminal to it.
+type SessionPlugin interface {
+	Start(session *ecs.Session, region, target, endpoint string) error
+}
+
+// SessionManagerPlugin runs the AWS session-manager-plugin, the same way the AWS CLI does.
+type SessionManagerPlugin struct {
+	Path   string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ErrNoSessionManagerPlugin is returned when the session-manager-plugin is not installed.
+var ErrNoSessionManagerPlugin = errors.New("session-manager-plugin is not on the PATH. Install it from " +
+	"https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html")
+
+// NewSessionManagerPlugin finds the session-manager-plugin on the PATH, attached to the terminal.
+func NewSessionManagerPlugin() (*SessionManagerPlugin, error) {
+	path, err := exec.LookPath("session-manager-plugin")
+	if err != nil {
+		return nil, ErrNoSessionManagerPlugin
+	}
+	return &SessionManagerPlugin{Path: path, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}, nil
+}
+
+// Start runs the plugin until the session ends. Interrupts are left to the plugin, which forwards
+// them to the remote command.
+func (p *SessionManagerPlugin) Start(session *ecs.Session, region, target, endpoint string) error {
+	args, err := SessionPluginArgs(session, region, target, endpoint)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(p.Path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = p.Stdin, p.Stdout, p.Stderr
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	return cmd.Run()
+}
+
+// SessionPluginArgs returns the arguments session-manager-plugin takes to start a session.
+func SessionPluginArgs(session *ecs.Session, region, target, endpoint string) ([]string, error) {
+	sessionJSON, err := json.Marshal(map[string]string{
+		"SessionId":  aws.StringValue(session.SessionId),
+		"StreamUrl":  aws.StringValue(session.StreamUrl),
+		"TokenValue": aws.StringValue(session.TokenValue),
+	})
+	if err != nil {
+		return nil, err
+	}
+	targetJSON, err := json.Marshal(map[string]string{"Target": target})
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(sessionJSON), region, "StartSession", "", string(targetJSON), endpoint}, nil
+}
+
+// ExecTarget returns the Session Manager target of a container, ecs:<cluster>_<task>_<runtime>.
+func ExecTarget(task *ecs.Task, container *ecs.Container) string {
+	cluster := ecsq.ParseARN(aws.StringValue(task.ClusterArn)).Name
+	taskID := ecsq.TaskID(aws.StringValue(task.TaskArn))
+	return fmt.Sprintf("ecs:%v_%v_%v", cluster, taskID, aws.StringValue(container.RuntimeId))
+}
+
+// ExecContainer picks the container to exec into and checks that ECS Exec can reach it. The name
+// may be empty if the task has a single container. The errors explain how to fix the task.
+func ExecContainer(task *ecs.Task, name string) (*ecs.Container, error) {
+	if !aws.BoolValue(task.EnableExecuteCommand) {
+		return nil, errors.New("ECS Exec is not enabled for this task. Enable it on the service with " +
+			"`aws ecs update-service --enable-execute-command --force-new-deployment`, then exec into one of the new tasks")
+	}
+	names := []string{}
+	var container *ecs.Container
+	for _, c := range task.Containers {
+		names = append(names, aws.StringValue(c.Name))
+		if aws.StringValue(c.Name) == name || (name == "" && len(task.Containers) == 1) {
+			container = c
+		}
+	}
+	if container == nil {
+		if name == "" {
+			return nil, fmt.Errorf("the task has several containers, pick one with --container: %v", strings.Join(names, ", "))
+		}
+		return nil, fmt.Errorf("the task has no container %q, its containers are %v", name, strings.Join(names, ", "))
+	}
+	for _, agent := range container.ManagedAgents {
+		if aws.StringValue(agent.Name) != ecs.ManagedAgentNameExecuteCommandAgent {
+			continue
+		}
+		if status := aws.StringValue(agent.LastStatus); status != "RUNNING" {
+			message := fmt.Sprintf("the ExecuteCommandAgent in container %v is %v", aws.StringValue(container.Name), status)
+			if reason := aws.StringValue(agent.Reason); reason != "" {
+				message += ": " + reason
+			}
+			return nil, errors.New(message + ". Check that the task role allows the ssmmessages actions, " +
+				"and that the task can reach the Systems Manager endpoints")
+		}
+		return container, nil
+	}
+	return nil, fmt.Errorf("the ExecuteCommandAgent is not running in container %v. The task may have started before "+
+		"ECS Exec was enabled, or its container agent or platform version may be too old to support it", aws.StringValue(container.Name))
+}
+
+// resolveTask returns the given task ID or ARN, or if a service name is given instead, the ARN of
+// an arbitrary running task of that service.
+func resolveTask(ctx context.Context, svc *ecs.ECS, clusterName, taskOrService string) (string, error) {
+	return newClient(svc).ResolveTask(ctx, clusterName, taskOrService)
+}
+
+// ExecuteCommand starts an ECS Exec session in the container of the task, and hands it to the
+// plugin.
+func ExecuteCommand(ctx context.Context, svc *ecs.ECS, plugin SessionPlugin, region, clusterName, taskOrService, containerName string, command []string) error {
+	taskID, err := resolveTask(ctx, svc, clusterName, taskOrService)
+	if err != nil {
+		return err
+	}
+	task, err := getTaskDetail(ctx, svc, clusterName, taskID)
+	if err != nil {
+		return err
+	}
+	container, err := ExecContainer(task, containerName)
+	if err != nil {
+		return err
+	}
+	result, err := svc.ExecuteCommandWithContext(ctx, &ecs.ExecuteCommandInput{
+		Cluster:     &clusterName,
+		Task:        task.TaskArn,
+		Container:   container.Name,
+		Command:     aws.String(ShellJoin(command)),
+		Interactive: aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+	return plugin.Start(result.Session, region, ExecTarget(task, container), svc.Endpoint)
+}
+
+// ShellJoin joins the arguments into a command line that the shell in the container splits back
+// into the same arguments. Arguments that aren't made up of safe characters are single-quoted.
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
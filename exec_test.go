@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestExecContainer(t *testing.T) {
+	agent := func(status string) []*ecs.ManagedAgent {
+		return []*ecs.ManagedAgent{{Name: aws.String("ExecuteCommandAgent"), LastStatus: aws.String(status)}}
+	}
+	task := &ecs.Task{
+		EnableExecuteCommand: aws.Bool(true),
+		Containers: []*ecs.Container{
+			{Name: aws.String("app"), ManagedAgents: agent("RUNNING")},
+			{Name: aws.String("sidecar"), ManagedAgents: agent("STOPPED")},
+		},
+	}
+	c, err := ExecContainer(task, "app")
+	assertTrue(t, err == nil && aws.StringValue(c.Name) == "app")
+	_, err = ExecContainer(task, "")
+	assertTrue(t, err != nil && strings.Contains(err.Error(), "--container: app, sidecar"))
+	_, err = ExecContainer(task, "sidecar")
+	assertTrue(t, err != nil && strings.Contains(err.Error(), "STOPPED"))
+	_, err = ExecContainer(task, "db")
+	assertTrue(t, err != nil)
+
+	single := &ecs.Task{EnableExecuteCommand: aws.Bool(true), Containers: []*ecs.Container{{Name: aws.String("app")}}}
+	_, err = ExecContainer(single, "")
+	assertTrue(t, err != nil && strings.Contains(err.Error(), "not running"))
+
+	single.EnableExecuteCommand = aws.Bool(false)
+	_, err = ExecContainer(single, "")
+	assertTrue(t, err != nil && strings.Contains(err.Error(), "--enable-execute-command"))
+}
+
+func TestSessionManagerPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub plugin is a shell script")
+	}
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "session-manager-plugin")
+	script := "#!/bin/sh\nfor arg in \"$@\"; do echo \"$arg\"; done\n"
+	assertTrue(t, os.WriteFile(stub, []byte(script), 0755) == nil)
+
+	var out bytes.Buffer
+	plugin := &SessionManagerPlugin{Path: stub, Stdout: &out, Stderr: &out}
+	task := &ecs.Task{
+		ClusterArn: aws.String("arn:aws:ecs:us-west-2:123456789012:cluster/ecs-prod"),
+		TaskArn:    aws.String("arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7"),
+	}
+	target := ExecTarget(task, &ecs.Container{RuntimeId: aws.String("6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7-1234")})
+	assertTrue(t, target == "ecs:ecs-prod_6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7_6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7-1234")
+
+	session := &ecs.Session{SessionId: aws.String("s-1"), StreamUrl: aws.String("wss://stream"), TokenValue: aws.String("token")}
+	err := plugin.Start(session, "us-west-2", target, "https://ecs.us-west-2.amazonaws.com")
+	assertTrue(t, err == nil)
+	expected := `{"SessionId":"s-1","StreamUrl":"wss://stream","TokenValue":"token"}
+us-west-2
+StartSession
+
+{"Target":"` + target + `"}
+https://ecs.us-west-2.amazonaws.com
+`
+	assertTrue(t, out.String() == expected)
+}
+
+func TestShellJoin(t *testing.T) {
+	assertTrue(t, ShellJoin([]string{"ls", "-la", "/app"}) == "ls -la /app")
+	assertTrue(t, ShellJoin([]string{"sh", "-c", "echo hi"}) == "sh -c 'echo hi'")
+	assertTrue(t, ShellJoin([]string{"echo", "it's", ""}) == `echo 'it'"'"'s' ''`)
+	assertTrue(t, ShellJoin([]string{"echo", "$HOME"}) == "echo '$HOME'")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// ServiceFilter decides whether a service should be shown.
+type ServiceFilter func(*ecs.Service) bool
+
+// ServiceFilterOptions holds the filters of the services command. Empty options match everything,
+// and every set option must match for a service to be shown.
+type ServiceFilterOptions struct {
+	// Substring matches services whose name contains it.
+	Substring string
+	// Regex matches services whose name matches it.
+	Regex string
+	// Status matches services with the given status, e.g. ACTIVE.
+	Status string
+	// Unhealthy matches services that are not running their desired count, or have pending tasks.
+	Unhealthy bool
+	// Deploying matches services with more than one deployment.
+	Deploying bool
+	// LaunchType matches services with the given launch type, e.g. FARGATE.
+	LaunchType string
+	// CapacityProvider matches services using the given capacity provider in their strategy.
+	CapacityProvider string
+	// Tags matches services whose tags satisfy all the selectors.
+	Tags []TagSelector
+}
+
+// NewServiceFilter composes the set options into a single filter.
+func NewServiceFilter(opts ServiceFilterOptions) (ServiceFilter, error) {
+	filters := []ServiceFilter{}
+	if opts.Substring != "" {
+		filters = append(filters, func(s *ecs.Service) bool {
+			return strings.Contains(aws.StringValue(s.ServiceName), opts.Substring)
+		})
+	}
+	if opts.Regex != "" {
+		re, err := regexp.Compile(opts.Regex)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(s *ecs.Service) bool {
+			return re.MatchString(aws.StringValue(s.ServiceName))
+		})
+	}
+	if opts.Status != "" {
+		filters = append(filters, func(s *ecs.Service) bool {
+			return strings.EqualFold(aws.StringValue(s.Status), opts.Status)
+		})
+	}
+	if opts.Unhealthy {
+		filters = append(filters, IsServiceUnhealthy)
+	}
+	if opts.Deploying {
+		filters = append(filters, func(s *ecs.Service) bool {
+			return len(s.Deployments) > 1
+		})
+	}
+	if opts.LaunchType != "" {
+		filters = append(filters, func(s *ecs.Service) bool {
+			return strings.EqualFold(aws.StringValue(s.LaunchType), opts.LaunchType)
+		})
+	}
+	if opts.CapacityProvider != "" {
+		filters = append(filters, func(s *ecs.Service) bool {
+			for _, item := range s.CapacityProviderStrategy {
+				if aws.StringValue(item.CapacityProvider) == opts.CapacityProvider {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if len(opts.Tags) > 0 {
+		filters = append(filters, func(s *ecs.Service) bool {
+			return MatchTags(opts.Tags, s.Tags)
+		})
+	}
+	return func(s *ecs.Service) bool {
+		for _, filter := range filters {
+			if !filter(s) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// IsServiceUnhealthy returns whether the service is not running its desired count of tasks, or has
+// pending tasks.
+func IsServiceUnhealthy(s *ecs.Service) bool {
+	return aws.Int64Value(s.RunningCount) != aws.Int64Value(s.DesiredCount) || aws.Int64Value(s.PendingCount) > 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestServiceFilter(t *testing.T) {
+	healthy := &ecs.Service{
+		ServiceName:  aws.String("applepicker"),
+		Status:       aws.String("ACTIVE"),
+		LaunchType:   aws.String("FARGATE"),
+		DesiredCount: aws.Int64(2),
+		RunningCount: aws.Int64(2),
+		PendingCount: aws.Int64(0),
+		Deployments:  []*ecs.Deployment{{}},
+	}
+	deploying := &ecs.Service{
+		ServiceName:  aws.String("helloworld"),
+		Status:       aws.String("ACTIVE"),
+		DesiredCount: aws.Int64(2),
+		RunningCount: aws.Int64(2),
+		PendingCount: aws.Int64(1),
+		Deployments:  []*ecs.Deployment{{}, {}},
+		CapacityProviderStrategy: []*ecs.CapacityProviderStrategyItem{
+			{CapacityProvider: aws.String("spot")},
+		},
+	}
+	cases := []struct {
+		opts     ServiceFilterOptions
+		expected []bool
+	}{
+		{ServiceFilterOptions{}, []bool{true, true}},
+		{ServiceFilterOptions{Substring: "apple"}, []bool{true, false}},
+		{ServiceFilterOptions{Regex: "^hello"}, []bool{false, true}},
+		{ServiceFilterOptions{Status: "DRAINING"}, []bool{false, false}},
+		{ServiceFilterOptions{Unhealthy: true}, []bool{false, true}},
+		{ServiceFilterOptions{Deploying: true}, []bool{false, true}},
+		{ServiceFilterOptions{LaunchType: "FARGATE"}, []bool{true, false}},
+		{ServiceFilterOptions{CapacityProvider: "spot"}, []bool{false, true}},
+		{ServiceFilterOptions{Unhealthy: true, Substring: "apple"}, []bool{false, false}},
+	}
+	for _, c := range cases {
+		filter, err := NewServiceFilter(c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, service := range []*ecs.Service{healthy, deploying} {
+			if got := filter(service); got != c.expected[i] {
+				t.Errorf("%+v on %v: expected %v, got %v", c.opts, *service.ServiceName, c.expected[i], got)
+			}
+		}
+	}
+	if _, err := NewServiceFilter(ServiceFilterOptions{Regex: "("}); err == nil {
+		t.Errorf("Expected an error for an invalid regex")
+	}
+}
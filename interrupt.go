@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// NewCommandContext returns the context commands run with. It is cancelled by the first Ctrl-C, or
+// once timeout passes if it is not zero. After the first Ctrl-C, a second one kills ecsq right
+// away, in case a command does not stop.
+func NewCommandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	cancel := stop
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, cancel
+}
+
+// Interrupted returns whether err was caused by the command's context being cancelled by Ctrl-C or
+// timing out. The AWS SDK does not wrap context errors, so the context itself is checked.
+func Interrupted(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil
+}
+
+// WarnPartialResults tells the user that the command stopped early and that what follows is
+// incomplete.
+func WarnPartialResults(w io.Writer, ctx context.Context) {
+	fmt.Fprintf(w, "%v, showing partial results\n", interruptReason(ctx))
+}
+
+func interruptReason(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "Timed out"
+	}
+	return "Interrupted"
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInterrupted(t *testing.T) {
+	ctx := context.Background()
+	assertFalse(t, Interrupted(ctx, errors.New("AccessDenied")))
+
+	ctx, cancel := NewCommandContext(time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assertTrue(t, Interrupted(ctx, errors.New("RequestCanceled: request context canceled")))
+	assertFalse(t, Interrupted(ctx, nil))
+	assertTrue(t, ClassifyError(InterruptedError(ctx)) == KindTimeout)
+	var out bytes.Buffer
+	WarnPartialResults(&out, ctx)
+	assertTrue(t, out.String() == "Timed out, showing partial results\n")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assertTrue(t, ClassifyError(InterruptedError(ctx)).ExitCode() == 130)
+}
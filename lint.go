@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// LintIgnoreLabel is the Docker label that allowlists lint rules for a container, as a
+// comma-separated list of rule names, or "all".
+const LintIgnoreLabel = "ecsq.lint.ignore"
+
+// LintRule is a check of a task definition.
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	// Check returns a message for each problem found in the container. Task-level rules only
+	// look at the task definition, and are run once with a nil container.
+	Check     func(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string
+	TaskLevel bool
+}
+
+// LintRules are the rules lint checks, with their default severities.
+var LintRules = []LintRule{
+	{Name: "privileged", Description: "Containers should not run privileged", Severity: SeverityCritical, Check: lintPrivileged},
+	{Name: "plaintext-secret", Description: "Secrets should come from Secrets Manager or Parameter Store, not plaintext environment variables", Severity: SeverityCritical, Check: lintPlaintextSecrets},
+	{Name: "host-network", Description: "Tasks should not use the host network mode", Severity: SeverityWarning, Check: lintHostNetwork, TaskLevel: true},
+	{Name: "root-user", Description: "Containers should run as a non-root user", Severity: SeverityWarning, Check: lintRootUser},
+	{Name: "writable-root-fs", Description: "Containers should have a read-only root filesystem", Severity: SeverityWarning, Check: lintWritableRootFilesystem},
+	{Name: "no-memory-limit", Description: "Containers should have a hard memory limit", Severity: SeverityWarning, Check: lintMemoryLimit},
+	{Name: "latest-tag", Description: "Images should be pinned to a tag other than latest, or a digest", Severity: SeverityWarning, Check: lintLatestTag},
+	{Name: "no-log-config", Description: "Containers should have a log configuration", Severity: SeverityWarning, Check: lintLogConfiguration},
+	{Name: "no-health-check", Description: "Essential containers should have a health check", Severity: SeverityInfo, Check: lintHealthCheck},
+}
+
+// LintRuleNames returns the names of the rules, for help and error messages.
+func LintRuleNames() []string {
+	names := []string{}
+	for _, r := range LintRules {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// LintOptions configures which rules run and how severe their findings are.
+type LintOptions struct {
+	Severities map[string]Severity
+	Disabled   map[string]bool
+}
+
+// ParseLintSeverities parses --severity values, rule=critical|warning|info|off.
+func ParseLintSeverities(flags map[string]string) (LintOptions, error) {
+	opts := LintOptions{Severities: map[string]Severity{}, Disabled: map[string]bool{}}
+	for rule, level := range flags {
+		found := false
+		for _, r := range LintRules {
+			found = found || r.Name == rule
+		}
+		if !found {
+			return opts, fmt.Errorf("unknown rule %q, valid rules are %v", rule, strings.Join(LintRuleNames(), ", "))
+		}
+		switch strings.ToLower(level) {
+		case "critical":
+			opts.Severities[rule] = SeverityCritical
+		case "warning":
+			opts.Severities[rule] = SeverityWarning
+		case "info":
+			opts.Severities[rule] = SeverityInfo
+		case "off":
+			opts.Disabled[rule] = true
+		default:
+			return opts, fmt.Errorf("invalid severity %q for %v, valid severities are critical, warning, info and off", level, rule)
+		}
+	}
+	return opts, nil
+}
+
+// LintTaskDefinition checks the task definition against every enabled rule. Rules listed in a
+// container's ecsq.lint.ignore label are skipped for that container, and task-level rules are
+// skipped if every container lists them.
+func LintTaskDefinition(td *ecs.TaskDefinition, opts LintOptions) []Finding {
+	findings := []Finding{}
+	resource := taskDefinitionRevision(aws.StringValue(td.TaskDefinitionArn))
+	for _, rule := range LintRules {
+		if opts.Disabled[rule.Name] {
+			continue
+		}
+		severity := rule.Severity
+		if s, ok := opts.Severities[rule.Name]; ok {
+			severity = s
+		}
+		if rule.TaskLevel {
+			ignored := len(td.ContainerDefinitions) > 0
+			for _, c := range td.ContainerDefinitions {
+				ignored = ignored && lintIgnored(c, rule.Name)
+			}
+			if ignored {
+				continue
+			}
+			for _, message := range rule.Check(td, nil) {
+				findings = append(findings, Finding{Severity: severity, Check: rule.Name, Resource: resource, Message: message})
+			}
+			continue
+		}
+		for _, c := range td.ContainerDefinitions {
+			if lintIgnored(c, rule.Name) {
+				continue
+			}
+			for _, message := range rule.Check(td, c) {
+				findings = append(findings, Finding{
+					Severity: severity,
+					Check:    rule.Name,
+					Resource: resource + "/" + aws.StringValue(c.Name),
+					Message:  message,
+				})
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity < findings[j].Severity
+	})
+	return findings
+}
+
+func lintIgnored(c *ecs.ContainerDefinition, rule string) bool {
+	for _, name := range SplitList(aws.StringValue(c.DockerLabels[LintIgnoreLabel])) {
+		if name == rule || name == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+func lintPrivileged(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if aws.BoolValue(c.Privileged) {
+		return []string{"runs privileged, with full access to the host"}
+	}
+	return nil
+}
+
+func lintRootUser(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	user := aws.StringValue(c.User)
+	name := strings.SplitN(user, ":", 2)[0]
+	switch name {
+	case "":
+		return []string{"has no user, so it runs as the image's default user, which is often root"}
+	case "root", "0":
+		return []string{"runs as root"}
+	}
+	return nil
+}
+
+func lintWritableRootFilesystem(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if !aws.BoolValue(c.ReadonlyRootFilesystem) {
+		return []string{"has a writable root filesystem"}
+	}
+	return nil
+}
+
+func lintHostNetwork(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if aws.StringValue(td.NetworkMode) == ecs.NetworkModeHost {
+		return []string{"uses the host network mode, sharing the host's network stack"}
+	}
+	return nil
+}
+
+func lintMemoryLimit(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if c.Memory == nil && aws.StringValue(td.Memory) == "" {
+		return []string{"has no hard memory limit, on the container or the task"}
+	}
+	return nil
+}
+
+func lintLatestTag(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if ImageTag(aws.StringValue(c.Image)) == "latest" {
+		return []string{fmt.Sprintf("image %v is not pinned to a tag or digest", aws.StringValue(c.Image))}
+	}
+	return nil
+}
+
+func lintLogConfiguration(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if c.LogConfiguration == nil {
+		return []string{"has no log configuration, so its logs are only on the host"}
+	}
+	return nil
+}
+
+func lintHealthCheck(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	if (c.Essential == nil || aws.BoolValue(c.Essential)) && c.HealthCheck == nil {
+		return []string{"is essential but has no health check"}
+	}
+	return nil
+}
+
+func lintPlaintextSecrets(td *ecs.TaskDefinition, c *ecs.ContainerDefinition) []string {
+	messages := []string{}
+	for _, env := range c.Environment {
+		if reason := SecretReason(aws.StringValue(env.Name), aws.StringValue(env.Value)); reason != "" {
+			messages = append(messages, fmt.Sprintf("environment variable %v looks like a plaintext secret: %v", aws.StringValue(env.Name), reason))
+		}
+	}
+	return messages
+}
+
+var secretNamePattern = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api_?key|private_?key|credential|access_?key)`)
+
+// Values at least this long with at least this much entropy per character look like generated
+// secrets, such as API keys.
+const (
+	secretMinLength  = 20
+	secretMinEntropy = 4.0
+)
+
+// SecretReason returns why a name and value look like a secret, or "" if they do not. The name
+// is matched against common secret names, and the value is checked for the high entropy of
+// generated keys and tokens.
+func SecretReason(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	if secretNamePattern.MatchString(name) {
+		return "the name suggests a secret"
+	}
+	if len(value) >= secretMinLength && !strings.ContainsAny(value, " /") && ShannonEntropy(value) >= secretMinEntropy {
+		return "the value has high entropy"
+	}
+	return ""
+}
+
+// ShannonEntropy returns the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// GetLintTaskDefinitions returns the task definitions of the cluster's services, or of the given
+// service only, each once.
+func GetLintTaskDefinitions(ctx context.Context, svc *ecs.ECS, clusterName, serviceName string) ([]*ecs.TaskDefinition, error) {
+	arns := []string{}
+	if serviceName != "" {
+		service, err := getServiceDetail(ctx, svc, clusterName, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, aws.StringValue(service.TaskDefinition))
+	} else {
+		services, err := listServices(ctx, svc, clusterName, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range services.Services {
+			arns = append(arns, aws.StringValue(s.TaskDefinition))
+		}
+	}
+	byArn, err := getTaskDefinitions(ctx, svc, arns)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(arns)
+	taskDefinitions := []*ecs.TaskDefinition{}
+	for i, arn := range arns {
+		if i > 0 && arns[i-1] == arn {
+			continue
+		}
+		taskDefinitions = append(taskDefinitions, byArn[arn])
+	}
+	return taskDefinitions, nil
+}
+
+// RenderLintFindings writes the findings as a table, JSON or SARIF.
+func RenderLintFindings(w io.Writer, findings []Finding, format string) error {
+	if format != "sarif" {
+		return RenderFindings(w, findings, format)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewSARIFLog(findings))
+}
+
+// sarifLog is a SARIF 2.1.0 log, with the fields lint fills in.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string      `json:"name"`
+			InformationURI string      `json:"informationUri"`
+			Rules          []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// NewSARIFLog converts lint findings to a SARIF log, for code scanning tools.
+func NewSARIFLog(findings []Finding) interface{} {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "ecsq"
+	run.Tool.Driver.InformationURI = "https://github.com/mightyguava/ecsq"
+	for _, r := range LintRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: r.Name, ShortDescription: sarifMessage{r.Description}})
+	}
+	for _, f := range findings {
+		level := "note"
+		switch f.Severity {
+		case SeverityCritical:
+			level = "error"
+		case SeverityWarning:
+			level = "warning"
+		}
+		location := sarifLocation{LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: f.Resource, Kind: "resource"}}}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    f.Check,
+			Level:     level,
+			Message:   sarifMessage{f.Resource + " " + f.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
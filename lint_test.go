@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func lintChecks(findings []Finding) map[string]Severity {
+	checks := map[string]Severity{}
+	for _, f := range findings {
+		checks[f.Check+" "+f.Resource] = f.Severity
+	}
+	return checks
+}
+
+func TestLintTaskDefinition(t *testing.T) {
+	td := &ecs.TaskDefinition{
+		TaskDefinitionArn: aws.String("arn:aws:ecs:us-west-2:123456789012:task-definition/applepicker:38"),
+		NetworkMode:       aws.String("host"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{
+				Name:       aws.String("app"),
+				Image:      aws.String("applepicker"),
+				Privileged: aws.Bool(true),
+				Environment: []*ecs.KeyValuePair{
+					{Name: aws.String("DB_PASSWORD"), Value: aws.String("hunter2")},
+					{Name: aws.String("UPSTREAM"), Value: aws.String("kX9vQ2mZ7rT4wY1pL8nB3cF6")},
+					{Name: aws.String("LOG_LEVEL"), Value: aws.String("info")},
+				},
+			},
+			{
+				Name:                   aws.String("sidecar"),
+				Image:                  aws.String("envoy:v1.25.1"),
+				User:                   aws.String("1000:1000"),
+				ReadonlyRootFilesystem: aws.Bool(true),
+				Memory:                 aws.Int64(256),
+				Essential:              aws.Bool(false),
+				LogConfiguration:       &ecs.LogConfiguration{LogDriver: aws.String("awslogs")},
+				DockerLabels:           map[string]*string{LintIgnoreLabel: aws.String("host-network")},
+			},
+		},
+	}
+	checks := lintChecks(LintTaskDefinition(td, LintOptions{}))
+	expected := map[string]Severity{
+		"privileged applepicker:38/app":       SeverityCritical,
+		"plaintext-secret applepicker:38/app": SeverityCritical,
+		"host-network applepicker:38":         SeverityWarning,
+		"root-user applepicker:38/app":        SeverityWarning,
+		"writable-root-fs applepicker:38/app": SeverityWarning,
+		"no-memory-limit applepicker:38/app":  SeverityWarning,
+		"latest-tag applepicker:38/app":       SeverityWarning,
+		"no-log-config applepicker:38/app":    SeverityWarning,
+		"no-health-check applepicker:38/app":  SeverityInfo,
+	}
+	assertTrue(t, len(checks) == len(expected))
+	for check, severity := range expected {
+		assertTrue(t, checks[check] == severity)
+	}
+	findings := LintTaskDefinition(td, LintOptions{})
+	secrets := 0
+	for _, f := range findings {
+		if f.Check == "plaintext-secret" {
+			secrets++
+		}
+	}
+	assertTrue(t, secrets == 2)
+
+	opts, err := ParseLintSeverities(map[string]string{"privileged": "warning", "latest-tag": "off", "no-health-check": "critical"})
+	assertTrue(t, err == nil)
+	checks = lintChecks(LintTaskDefinition(td, opts))
+	assertTrue(t, checks["privileged applepicker:38/app"] == SeverityWarning)
+	assertTrue(t, checks["no-health-check applepicker:38/app"] == SeverityCritical)
+	_, ok := checks["latest-tag applepicker:38/app"]
+	assertFalse(t, ok)
+
+	td.ContainerDefinitions[0].DockerLabels = map[string]*string{LintIgnoreLabel: aws.String("all")}
+	checks = lintChecks(LintTaskDefinition(td, LintOptions{}))
+	assertTrue(t, len(checks) == 0)
+
+	_, err = ParseLintSeverities(map[string]string{"nope": "info"})
+	assertTrue(t, err != nil)
+	_, err = ParseLintSeverities(map[string]string{"privileged": "loud"})
+	assertTrue(t, err != nil)
+}
+
+func TestSecretReason(t *testing.T) {
+	assertTrue(t, SecretReason("API_KEY", "abc") != "")
+	assertTrue(t, SecretReason("API_KEY", "") == "")
+	assertTrue(t, SecretReason("SESSION", "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY") == "")
+	assertTrue(t, SecretReason("SESSION", "wJalrXUtnFEMIK7MDENGbPxRfiCYEXAMPLEKEY") != "")
+	assertTrue(t, SecretReason("GREETING", "hello hello hello hello") == "")
+	assertTrue(t, ShannonEntropy("aaaa") == 0)
+	assertTrue(t, ShannonEntropy("abcd") == 2)
+}
+
+func TestSARIFLog(t *testing.T) {
+	var out bytes.Buffer
+	findings := []Finding{{Severity: SeverityCritical, Check: "privileged", Resource: "applepicker:38/app", Message: "runs privileged"}}
+	assertTrue(t, RenderLintFindings(&out, findings, "sarif") == nil)
+	var log struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID string
+				Level  string
+			}
+		}
+	}
+	assertTrue(t, json.Unmarshal(out.Bytes(), &log) == nil)
+	assertTrue(t, log.Version == "2.1.0")
+	assertTrue(t, log.Runs[0].Results[0].RuleID == "privileged" && log.Runs[0].Results[0].Level == "error")
+}
+
+func TestLintSeverityFlag(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	var code int
+	stdout, _ := captureOutput(t, func() {
+		code = run([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache", "lint", "ecs-prod", "--severity", "root-user=off"})
+	})
+	assertTrue(t, code == 0)
+	assertFalse(t, strings.Contains(stdout, "root-user"))
+}
+
+func TestLintExitCode(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	lint := func(args ...string) int {
+		var code int
+		captureOutput(t, func() {
+			code = run(append([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache", "lint", "ecs-prod"}, args...))
+		})
+		return code
+	}
+	assertTrue(t, lint() == 0)
+	// Critical findings have their own exit code, apart from the error codes.
+	assertTrue(t, lint("--severity", "root-user=critical") == ExitFindings)
+	assertTrue(t, ExitFindings != KindError.ExitCode())
+}
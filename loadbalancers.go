@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ServiceLoadBalancer is a load balancer or target group a service registers its tasks with.
+type ServiceLoadBalancer struct {
+	// LoadBalancerNames are the load balancers that route to the target group. For a classic load
+	// balancer, it is the load balancer itself.
+	LoadBalancerNames []string
+	TargetGroupArn    string
+	ContainerName     string
+	ContainerPort     int64
+	Targets           []TargetHealth
+	Routes            []ListenerRoute
+}
+
+// TargetGroupName returns the name of the target group, or "" for a classic load balancer.
+func (lb ServiceLoadBalancer) TargetGroupName() string {
+	if lb.TargetGroupArn == "" {
+		return ""
+	}
+	return strings.SplitN(ecsq.ParseARN(lb.TargetGroupArn).Name, "/", 2)[0]
+}
+
+// TargetHealth is the health of a target registered in a target group.
+type TargetHealth struct {
+	ID          string
+	Port        int64
+	State       string
+	Reason      string
+	Description string
+	// Task is the ID of the task the target maps to, or "" if no running task matches it.
+	Task string
+}
+
+// ListenerRoute is a listener rule that forwards to a target group.
+type ListenerRoute struct {
+	Listener string
+	Priority string
+	Hosts    []string
+	Paths    []string
+}
+
+// GetServiceLoadBalancers describes every load balancer of the service, the health of the targets
+// in its target groups, and the listener rules that route to them.
+func GetServiceLoadBalancers(ctx context.Context, svc *ecs.ECS, elb *elbv2.ELBV2, clusterName string, service *ecs.Service) ([]ServiceLoadBalancer, error) {
+	if len(service.LoadBalancers) == 0 {
+		return nil, nil
+	}
+	targets, err := getTaskTargets(ctx, svc, clusterName, aws.StringValue(service.ServiceName))
+	if err != nil {
+		return nil, err
+	}
+	result := []ServiceLoadBalancer{}
+	listenerRules := map[string][]*elbv2.Rule{}
+	for _, config := range service.LoadBalancers {
+		lb := ServiceLoadBalancer{
+			TargetGroupArn: aws.StringValue(config.TargetGroupArn),
+			ContainerName:  aws.StringValue(config.ContainerName),
+			ContainerPort:  aws.Int64Value(config.ContainerPort),
+		}
+		if lb.TargetGroupArn == "" {
+			lb.LoadBalancerNames = []string{aws.StringValue(config.LoadBalancerName)}
+			result = append(result, lb)
+			continue
+		}
+		groups, err := elb.DescribeTargetGroupsWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+			TargetGroupArns: []*string{config.TargetGroupArn},
+		})
+		if err != nil {
+			return nil, err
+		}
+		health, err := elb.DescribeTargetHealthWithContext(ctx, &elbv2.DescribeTargetHealthInput{TargetGroupArn: config.TargetGroupArn})
+		if err != nil {
+			return nil, err
+		}
+		lb.Targets = NewTargetHealth(health.TargetHealthDescriptions, targets)
+		for _, group := range groups.TargetGroups {
+			for _, lbArn := range group.LoadBalancerArns {
+				lb.LoadBalancerNames = append(lb.LoadBalancerNames, loadBalancerName(aws.StringValue(lbArn)))
+				rules, err := getListenerRules(ctx, elb, aws.StringValue(lbArn), listenerRules)
+				if err != nil {
+					return nil, err
+				}
+				lb.Routes = append(lb.Routes, RoutesToTargetGroup(rules, lb.TargetGroupArn)...)
+			}
+		}
+		result = append(result, lb)
+	}
+	return result, nil
+}
+
+// getListenerRules returns the rules of every listener of the load balancer, keyed by listener.
+// Rules are memoized in seen, as several target groups may share a load balancer.
+func getListenerRules(ctx context.Context, elb *elbv2.ELBV2, loadBalancerArn string, seen map[string][]*elbv2.Rule) (map[string][]*elbv2.Rule, error) {
+	rules := map[string][]*elbv2.Rule{}
+	listeners := []*elbv2.Listener{}
+	err := elb.DescribeListenersPagesWithContext(ctx, &elbv2.DescribeListenersInput{LoadBalancerArn: &loadBalancerArn},
+		func(page *elbv2.DescribeListenersOutput, lastPage bool) bool {
+			listeners = append(listeners, page.Listeners...)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, listener := range listeners {
+		name := fmt.Sprintf("%v:%v", aws.StringValue(listener.Protocol), aws.Int64Value(listener.Port))
+		arn := aws.StringValue(listener.ListenerArn)
+		if _, ok := seen[arn]; !ok {
+			listenerRules, err := describeRules(ctx, elb, arn)
+			if err != nil {
+				return nil, err
+			}
+			seen[arn] = listenerRules
+		}
+		rules[name] = seen[arn]
+	}
+	return rules, nil
+}
+
+// describeRules returns every rule of a listener. The SDK has no pager for DescribeRules, so the
+// pages are followed by marker.
+func describeRules(ctx context.Context, elb *elbv2.ELBV2, listenerArn string) ([]*elbv2.Rule, error) {
+	rules := []*elbv2.Rule{}
+	input := &elbv2.DescribeRulesInput{ListenerArn: aws.String(listenerArn)}
+	for {
+		out, err := elb.DescribeRulesWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, out.Rules...)
+		if aws.StringValue(out.NextMarker) == "" {
+			return rules, nil
+		}
+		input.Marker = out.NextMarker
+	}
+}
+
+// RoutesToTargetGroup picks the rules, keyed by listener, that forward to the target group.
+func RoutesToTargetGroup(rules map[string][]*elbv2.Rule, targetGroupArn string) []ListenerRoute {
+	listeners := []string{}
+	for listener := range rules {
+		listeners = append(listeners, listener)
+	}
+	sort.Strings(listeners)
+	routes := []ListenerRoute{}
+	for _, listener := range listeners {
+		for _, rule := range rules[listener] {
+			if !forwardsTo(rule.Actions, targetGroupArn) {
+				continue
+			}
+			route := ListenerRoute{Listener: listener, Priority: aws.StringValue(rule.Priority)}
+			for _, c := range rule.Conditions {
+				switch aws.StringValue(c.Field) {
+				case "host-header":
+					if c.HostHeaderConfig != nil {
+						route.Hosts = append(route.Hosts, aws.StringValueSlice(c.HostHeaderConfig.Values)...)
+					} else {
+						route.Hosts = append(route.Hosts, aws.StringValueSlice(c.Values)...)
+					}
+				case "path-pattern":
+					if c.PathPatternConfig != nil {
+						route.Paths = append(route.Paths, aws.StringValueSlice(c.PathPatternConfig.Values)...)
+					} else {
+						route.Paths = append(route.Paths, aws.StringValueSlice(c.Values)...)
+					}
+				}
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func forwardsTo(actions []*elbv2.Action, targetGroupArn string) bool {
+	for _, action := range actions {
+		if aws.StringValue(action.TargetGroupArn) == targetGroupArn {
+			return true
+		}
+		if action.ForwardConfig != nil {
+			for _, tg := range action.ForwardConfig.TargetGroups {
+				if aws.StringValue(tg.TargetGroupArn) == targetGroupArn {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// getTaskTargets maps the targets the service's running tasks register as to the task IDs.
+func getTaskTargets(ctx context.Context, svc *ecs.ECS, clusterName, serviceName string) (map[string]string, error) {
+	arns, err := getTasksArns(ctx, svc, clusterName, serviceName, ecs.DesiredStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := describeTasks(ctx, svc, clusterName, arns)
+	if err != nil {
+		return nil, err
+	}
+	// Only the instances the tasks run on are described, not every instance in the cluster.
+	containerInstanceArns := []string{}
+	for _, task := range tasks.Tasks {
+		if task.ContainerInstanceArn != nil {
+			containerInstanceArns = append(containerInstanceArns, *task.ContainerInstanceArn)
+		}
+	}
+	instanceIDs := map[string]string{}
+	instances, err := newClient(svc).DescribeContainerInstances(ctx, clusterName, containerInstanceArns)
+	if err != nil {
+		return nil, err
+	}
+	for _, ci := range instances {
+		instanceIDs[aws.StringValue(ci.ContainerInstanceArn)] = aws.StringValue(ci.Ec2InstanceId)
+	}
+	return TaskTargets(tasks.Tasks, instanceIDs), nil
+}
+
+// TaskTargets maps the targets that tasks register as to the task IDs. Tasks using awsvpc
+// networking register by IP, keyed by the IP alone. Tasks using bridge or host networking register
+// by EC2 instance ID and host port, keyed as <instance>:<port>. instanceIDs maps container
+// instance ARNs to EC2 instance IDs.
+func TaskTargets(tasks []*ecs.Task, instanceIDs map[string]string) map[string]string {
+	targets := map[string]string{}
+	for _, task := range tasks {
+		id := ecsq.ParseARN(aws.StringValue(task.TaskArn)).Name
+		if i := strings.LastIndex(id, "/"); i >= 0 {
+			id = id[i+1:]
+		}
+		instance := instanceIDs[aws.StringValue(task.ContainerInstanceArn)]
+		for _, c := range task.Containers {
+			for _, ni := range c.NetworkInterfaces {
+				if ip := aws.StringValue(ni.PrivateIpv4Address); ip != "" {
+					targets[ip] = id
+				}
+			}
+			for _, binding := range c.NetworkBindings {
+				if instance != "" {
+					targets[fmt.Sprintf("%v:%v", instance, aws.Int64Value(binding.HostPort))] = id
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// NewTargetHealth converts target health descriptions, matching each target to a task.
+func NewTargetHealth(descriptions []*elbv2.TargetHealthDescription, taskTargets map[string]string) []TargetHealth {
+	targets := []TargetHealth{}
+	for _, d := range descriptions {
+		t := TargetHealth{}
+		if d.Target != nil {
+			t.ID = aws.StringValue(d.Target.Id)
+			t.Port = aws.Int64Value(d.Target.Port)
+		}
+		if d.TargetHealth != nil {
+			t.State = aws.StringValue(d.TargetHealth.State)
+			t.Reason = aws.StringValue(d.TargetHealth.Reason)
+			t.Description = aws.StringValue(d.TargetHealth.Description)
+		}
+		if task, ok := taskTargets[fmt.Sprintf("%v:%v", t.ID, t.Port)]; ok {
+			t.Task = task
+		} else {
+			t.Task = taskTargets[t.ID]
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// loadBalancerName returns the name of a load balancer from its ARN, which looks like
+// arn:aws:elasticloadbalancing:<region>:<account>:loadbalancer/app/<name>/<id>.
+func loadBalancerName(arn string) string {
+	pieces := strings.Split(ecsq.ParseARN(arn).Name, "/")
+	if len(pieces) >= 2 {
+		return pieces[1]
+	}
+	return pieces[0]
+}
+
+// RenderServiceLoadBalancers writes the load balancers, targets and listener rules as tables.
+func RenderServiceLoadBalancers(w io.Writer, lbs []ServiceLoadBalancer) {
+	if len(lbs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Load Balancers")
+	table := NewTable(w)
+	table.SetHeader([]string{"Load Balancer", "Target Group", "Container", "Port"})
+	for _, lb := range lbs {
+		table.Append([]string{
+			strings.Join(lb.LoadBalancerNames, ", "),
+			lb.TargetGroupName(),
+			lb.ContainerName,
+			strconv.FormatInt(lb.ContainerPort, 10),
+		})
+	}
+	table.Render()
+
+	header := []string{"Target Group", "Target", "Port", "State", "Reason", "Task"}
+	rows := [][]string{}
+	for _, lb := range lbs {
+		for _, t := range lb.Targets {
+			reason := t.Reason
+			if t.Description != "" {
+				reason = strings.TrimSpace(reason + " " + t.Description)
+			}
+			rows = append(rows, []string{lb.TargetGroupName(), t.ID, strconv.FormatInt(t.Port, 10), t.State, reason, t.Task})
+		}
+	}
+	if len(rows) > 0 {
+		fmt.Fprintln(w, "Targets")
+		table = NewTable(w)
+		table.SetHeader(header)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+		table.Render()
+	}
+
+	header = []string{"Target Group", "Listener", "Priority", "Hosts", "Paths"}
+	rows = [][]string{}
+	for _, lb := range lbs {
+		for _, r := range lb.Routes {
+			rows = append(rows, []string{lb.TargetGroupName(), r.Listener, r.Priority, strings.Join(r.Hosts, ", "), strings.Join(r.Paths, ", ")})
+		}
+	}
+	if len(rows) > 0 {
+		fmt.Fprintln(w, "Listener Rules")
+		table = NewTable(w)
+		table.SetHeader(header)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+		table.Render()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+func TestTaskTargets(t *testing.T) {
+	tasks := []*ecs.Task{
+		{
+			TaskArn: aws.String("arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/0b9a2c51d3e44f7c9e0f1a2b3c4d5e6f"),
+			Containers: []*ecs.Container{{
+				NetworkInterfaces: []*ecs.NetworkInterface{{PrivateIpv4Address: aws.String("10.0.12.34")}},
+			}},
+		},
+		{
+			TaskArn:              aws.String("arn:aws:ecs:us-west-2:123456789012:task/6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7"),
+			ContainerInstanceArn: aws.String("arn:aws:ecs:us-west-2:123456789012:container-instance/abc"),
+			Containers: []*ecs.Container{{
+				NetworkBindings: []*ecs.NetworkBinding{{ContainerPort: aws.Int64(8000), HostPort: aws.Int64(32768)}},
+			}},
+		},
+	}
+	targets := TaskTargets(tasks, map[string]string{"arn:aws:ecs:us-west-2:123456789012:container-instance/abc": "i-1"})
+
+	health := NewTargetHealth([]*elbv2.TargetHealthDescription{
+		{Target: &elbv2.TargetDescription{Id: aws.String("10.0.12.34"), Port: aws.Int64(8000)}, TargetHealth: &elbv2.TargetHealth{State: aws.String("healthy")}},
+		{Target: &elbv2.TargetDescription{Id: aws.String("i-1"), Port: aws.Int64(32768)}, TargetHealth: &elbv2.TargetHealth{State: aws.String("unhealthy"), Reason: aws.String("Target.Timeout")}},
+		{Target: &elbv2.TargetDescription{Id: aws.String("i-1"), Port: aws.Int64(32769)}, TargetHealth: &elbv2.TargetHealth{State: aws.String("draining")}},
+	}, targets)
+	assertTrue(t, len(health) == 3)
+	assertTrue(t, health[0].Task == "0b9a2c51d3e44f7c9e0f1a2b3c4d5e6f")
+	assertTrue(t, health[1].Task == "6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7" && health[1].Reason == "Target.Timeout")
+	assertTrue(t, health[2].Task == "")
+}
+
+func TestRoutesToTargetGroup(t *testing.T) {
+	tg := "arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/applepicker-prod/73e2d6bc24d8a067"
+	rules := map[string][]*elbv2.Rule{
+		"HTTPS:443": {
+			{
+				Priority: aws.String("10"),
+				Actions:  []*elbv2.Action{{TargetGroupArn: aws.String(tg)}},
+				Conditions: []*elbv2.RuleCondition{
+					{Field: aws.String("host-header"), HostHeaderConfig: &elbv2.HostHeaderConditionConfig{Values: aws.StringSlice([]string{"apples.example.com"})}},
+					{Field: aws.String("path-pattern"), Values: aws.StringSlice([]string{"/api/*"})},
+				},
+			},
+			{Priority: aws.String("20"), Actions: []*elbv2.Action{{TargetGroupArn: aws.String("other")}}},
+		},
+		"HTTP:80": {
+			{
+				Priority: aws.String("default"),
+				Actions: []*elbv2.Action{{ForwardConfig: &elbv2.ForwardActionConfig{
+					TargetGroups: []*elbv2.TargetGroupTuple{{TargetGroupArn: aws.String(tg)}},
+				}}},
+			},
+		},
+	}
+	routes := RoutesToTargetGroup(rules, tg)
+	assertTrue(t, len(routes) == 2)
+	assertTrue(t, routes[0].Listener == "HTTP:80" && routes[0].Priority == "default")
+	assertTrue(t, routes[1].Listener == "HTTPS:443" && routes[1].Hosts[0] == "apples.example.com" && routes[1].Paths[0] == "/api/*")
+
+	assertTrue(t, ServiceLoadBalancer{TargetGroupArn: tg}.TargetGroupName() == "applepicker-prod")
+	assertTrue(t, loadBalancerName("arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/app/prod-public/50dc6c495c0c9188") == "prod-public")
+}
+
+func TestDescribeRulesPages(t *testing.T) {
+	t.Setenv("AWS_CA_BUNDLE", "")
+	pages := map[string]string{
+		"":   `<Rules><member><RuleArn>rule-1</RuleArn></member></Rules><NextMarker>m1</NextMarker>`,
+		"m1": `<Rules><member><RuleArn>rule-2</RuleArn></member></Rules>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte("<DescribeRulesResponse><DescribeRulesResult>" + pages[values.Get("Marker")] + "</DescribeRulesResult></DescribeRulesResponse>"))
+	}))
+	defer server.Close()
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+	}))
+	rules, err := describeRules(context.Background(), elbv2.New(sess), "listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, len(rules) == 2)
+	assertTrue(t, aws.StringValue(rules[1].RuleArn) == "rule-2")
+}
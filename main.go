@@ -1,9 +1,10 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"regexp"
 	"strconv"
@@ -12,143 +13,330 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
 
 	kingpin "github.com/alecthomas/kingpin/v2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
 	"github.com/olekukonko/tablewriter"
 )
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs ecsq with the given command line and returns the exit code.
+func run(args []string) int {
 	var (
-		sess       *session.Session
-		svc        *ecs.ECS
-		AWSProfile string
-		AWSRegion  string
+		sess        *session.Session
+		svc         *ecs.ECS
+		AWSProfile  string
+		AWSRegion   string
+		timeout     time.Duration
+		ctx         = context.Background()
+		cancel      = func() {}
+		errorFormat string
+		jsonErrors  bool
+		exitCode    int
+		apiLog      *APICallLog
+		debug       bool
+		trace       bool
 	)
+	defer func() { cancel() }()
 
 	app := kingpin.New("ecsq", "A friendly ECS CLI")
 	app.Flag("profile", "AWS profile to use. Overrides the ~/.aws/config and AWS_DEFAULT_PROFILE").StringVar(&AWSProfile)
 	app.Flag("region", "AWS region").Envar("AWS_DEFAULT_REGION").StringVar(&AWSRegion)
+	app.Flag("timeout", "Stop the command if it takes longer than this, printing what it has found so far where it can. 0 means no timeout").
+		Default("0").DurationVar(&timeout)
+	app.Flag("debug", "Log every AWS API call to stderr, with its parameters, latency, retries and request ID, and print a summary of the calls at the end").
+		BoolVar(&debug)
+	app.Flag("trace", "Like --debug, and also log each failed attempt that is retried").BoolVar(&trace)
+	app.Flag("error-format", "Format to print errors in. The options are: text, json. With json, the error is printed to stdout in place of the results").
+		Envar("ECSQ_ERROR_FORMAT").Default("text").EnumVar(&errorFormat, "text", "json")
+	var (
+		cache        *ResponseCache
+		noCache      bool
+		offline      bool
+		cacheTTLFlag = map[string]string{}
+	)
+	app.Flag("no-cache", "Do not serve List and Describe responses from the on-disk cache. Fresh responses are still cached, including task definitions with their environment variables in plain text").BoolVar(&noCache)
+	app.Flag("offline", "Serve every response from the on-disk cache, regardless of age, without making any requests").BoolVar(&offline)
+	app.Flag("cache-ttl", "How long to cache responses for a resource, as <resource>=<duration>. Resources are clusters, services, tasks, task-definitions, task-definition-revision, container-instances and instances").
+		StringMapVar(&cacheTTLFlag)
+	var (
+		endpointURLs []string
+		noVerifySSL  bool
+		caBundle     string
+	)
+	app.Flag("endpoint-url", "Send AWS requests to this URL instead, such as LocalStack. Either <service>=<url>, or a URL for every service. Services are "+strings.Join(EndpointServiceNames(), ", ")+". Can be repeated").
+		StringsVar(&endpointURLs)
+	app.Flag("no-verify-ssl", "Do not verify TLS certificates of AWS endpoints").BoolVar(&noVerifySSL)
+	app.Flag("ca-bundle", "PEM file of CA certificates to verify TLS certificates of AWS endpoints with. Overrides AWS_CA_BUNDLE").
+		ExistingFileVar(&caBundle)
+	var (
+		recordDir string
+		replayDir string
+	)
+	app.Flag("record", "Save every AWS request and response to this directory, with credentials and secrets scrubbed, to replay later with --replay").
+		PlaceHolder("DIR").StringVar(&recordDir)
+	app.Flag("replay", "Serve AWS responses from a directory saved with --record, without making any requests").
+		PlaceHolder("DIR").ExistingDirVar(&replayDir)
 	config := aws.Config{}
-	app.PreAction(func(ctx *kingpin.ParseContext) error {
+	app.PreAction(func(pc *kingpin.ParseContext) error {
+		ctx, cancel = NewCommandContext(timeout)
 		if AWSRegion != "" {
 			config.Region = aws.String(AWSRegion)
 		}
-		// Initialize the session and service before any commands are run
-		sess = session.Must(session.NewSessionWithOptions(session.Options{
+		cacheTTLs, err := ParseCacheTTLs(cacheTTLFlag)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --cache-ttl")
+		}
+		cache = &ResponseCache{
+			Dir:      DefaultCacheDir(),
+			Identity: CacheIdentity(AWSProfile),
+			TTLs:     cacheTTLs,
+			Refresh:  noCache,
+			Offline:  offline,
+		}
+		config.HTTPClient = &http.Client{Transport: NewTransport(noVerifySSL)}
+		if recordDir != "" && replayDir != "" {
+			return NewError(KindInvalidInput, "--record and --replay cannot be used together")
+		}
+		if offline {
+			config.Credentials = credentials.AnonymousCredentials
+		}
+		if replayDir != "" {
+			// Requests are still signed, so the region they are made in is known even with a custom
+			// endpoint.
+			config.Credentials = credentials.NewStaticCredentials("replay", "replay", "")
+		}
+		flagEndpoints, err := ParseEndpointURLs(endpointURLs)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --endpoint-url")
+		}
+		fileEndpoints, err := ConfigFileEndpoints(DefaultAWSConfigFile(), awsProfileName(AWSProfile))
+		if err != nil {
+			return WrapError(err, "Could not read endpoints from the AWS config file")
+		}
+		config.EndpointResolver = NewEndpointResolver(flagEndpoints, EnvEndpoints(os.Getenv), fileEndpoints)
+		options := session.Options{
 			Config:                  config,
 			Profile:                 AWSProfile,
 			AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
 			SharedConfigState:       session.SharedConfigEnable,
-		}))
+		}
+		if caBundle != "" {
+			f, err := os.Open(caBundle)
+			if err != nil {
+				return InvalidInputError(err, "Invalid --ca-bundle")
+			}
+			defer f.Close()
+			options.CustomCABundle = f
+		}
+		// Initialize the session and service before any commands are run
+		sess, err = session.NewSessionWithOptions(options)
+		if err != nil {
+			return WrapError(err, "Could not create AWS session")
+		}
+		// The SDK can only load a CA bundle into an *http.Transport, so the cache goes in front of
+		// the transport once the session is created.
+		cache.Next = config.HTTPClient.Transport
+		config.HTTPClient.Transport = cache
+		if recordDir != "" {
+			recorder, err := NewRecorder(recordDir, cache)
+			if err != nil {
+				return WrapError(err, "Could not create the recording directory")
+			}
+			config.HTTPClient.Transport = recorder
+		}
+		if replayDir != "" {
+			replayer, err := NewReplayer(replayDir)
+			if err != nil {
+				return InvalidInputError(err, "Invalid --replay")
+			}
+			config.HTTPClient.Transport = replayer
+		}
+		if debug || trace {
+			apiLog = NewAPICallLog(os.Stderr, trace)
+			apiLog.Install(&sess.Handlers)
+		}
 		AWSRegion = *sess.ClientConfig(ecs.ServiceName).Config.Region
 		svc = ecs.New(sess)
 		return nil
 	})
-	app.Command("clusters", "List existing clusters").
-		Action(func(ctx *kingpin.ParseContext) error {
-			result, err := svc.ListClusters(&ecs.ListClustersInput{})
-			app.FatalIfError(err, "Could not list clusters")
-			clusters, err := svc.DescribeClusters(&ecs.DescribeClustersInput{Clusters: result.ClusterArns})
-			app.FatalIfError(err, "Could not describe clusters")
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetHeader([]string{
-				"Cluster Name",
-				"Container Instances",
-				"Active Services",
-				"Running Tasks",
-				"Pending Tasks",
-			})
-			ClusterSlice(clusters.Clusters).Sort()
-			for _, cluster := range clusters.Clusters {
-				table.Append([]string{
-					*cluster.ClusterName,
-					strconv.FormatInt(*cluster.RegisteredContainerInstancesCount, 10),
-					strconv.FormatInt(*cluster.ActiveServicesCount, 10),
-					strconv.FormatInt(*cluster.RunningTasksCount, 10),
-					strconv.FormatInt(*cluster.PendingTasksCount, 10),
-				})
-			}
-			table.Render()
-			return nil
+	var (
+		flagTags         []string
+		flagTagColumns   []string
+		flagColumns      string
+		flagOutput       string
+		listClustersSort string
+	)
+	listClustersCommand := app.Command("clusters", "List existing clusters")
+	RequirePermissions(listClustersCommand, "ecs:ListClusters", "ecs:DescribeClusters")
+	listClustersCommand.Flag("tag", "Only show clusters whose tags match, as key=value, key!=value, key (tag exists) or !key (tag does not exist). Can be repeated").
+		StringsVar(&flagTags)
+	listClustersCommand.Flag("tag-column", "Add a column with the value of this tag. Can be repeated").StringsVar(&flagTagColumns)
+	listClustersCommand.Flag("sort", "Comma-separated keys to sort by, prefixed with - for descending order. Keys are "+strings.Join(SortKeyNames(ClusterSortKeys), ", ")).
+		Default("name").StringVar(&listClustersSort)
+	listClustersCommand.Flag("columns", "Comma-separated columns to show, in order. Columns are "+strings.Join(ColumnNames(ClusterColumns("")), ", ")).
+		StringVar(&flagColumns)
+	listClustersCommand.Flag("output", "Table layout. The options are: table, wide. wide adds the status, ARN and link columns").
+		Short('o').Default("table").EnumVar(&flagOutput, "table", "wide")
+	listClustersCommand.Action(func(*kingpin.ParseContext) error {
+		selectors, err := ParseTagSelectors(flagTags)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --tag")
+		}
+		sorter, err := ParseSort(listClustersSort, ClusterSortKeys)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --sort")
+		}
+		columns, err := SelectColumns(ClusterColumns(AWSRegion), SplitList(flagColumns), flagOutput == "wide")
+		if err != nil {
+			return InvalidInputError(err, "Invalid --columns")
+		}
+		columns = append(columns, TagColumns(flagTagColumns, func(c *ecs.Cluster) []*ecs.Tag { return c.Tags })...)
+		result, err := svc.ListClustersWithContext(ctx, &ecs.ListClustersInput{})
+		if err != nil {
+			return WrapError(err, "Could not list clusters")
+		}
+		clusters, err := svc.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+			Clusters: result.ClusterArns,
+			Include:  []*string{aws.String(ecs.ClusterFieldTags)},
 		})
+		if err != nil {
+			return WrapError(err, "Could not describe clusters")
+		}
+		sorter.Sort(clusters.Clusters)
+		matched := []*ecs.Cluster{}
+		for _, cluster := range clusters.Clusters {
+			if MatchTags(selectors, cluster.Tags) {
+				matched = append(matched, cluster)
+			}
+		}
+		RenderTable(os.Stdout, columns, matched)
+		return nil
+	})
 	var (
 		argClusterName       string
 		listServicesShowLink bool
-		listServicesFilter   string
+		listServicesFilters  ServiceFilterOptions
+		listServicesSort     string
 	)
 	listServicesCommand := app.Command("services", "List services within the cluster")
+	RequirePermissions(listServicesCommand, "ecs:ListServices", "ecs:DescribeServices")
 	listServicesCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
-	listServicesCommand.Flag("link", "Whether to render links to the AWS console").BoolVar(&listServicesShowLink)
-	listServicesCommand.Flag("filter", "Service name to filter for, as a substring.").StringVar(&listServicesFilter)
-	listServicesCommand.Action(func(ctx *kingpin.ParseContext) error {
-		services := &ecs.DescribeServicesOutput{}
+	listServicesCommand.Flag("link", "Whether to render links to the AWS console. Same as adding the link column").BoolVar(&listServicesShowLink)
+	listServicesCommand.Flag("filter", "Service name to filter for, as a substring.").StringVar(&listServicesFilters.Substring)
+	listServicesCommand.Flag("regex", "Service name to filter for, as a regular expression.").StringVar(&listServicesFilters.Regex)
+	listServicesCommand.Flag("status", "Only show services with this status. The options are ACTIVE, DRAINING and INACTIVE").
+		EnumVar(&listServicesFilters.Status, "ACTIVE", "DRAINING", "INACTIVE")
+	listServicesCommand.Flag("unhealthy", "Only show services that are not running their desired count, or have pending tasks").
+		BoolVar(&listServicesFilters.Unhealthy)
+	listServicesCommand.Flag("deploying", "Only show services with more than one deployment").BoolVar(&listServicesFilters.Deploying)
+	listServicesCommand.Flag("launch-type", "Only show services with this launch type. The options are EC2, FARGATE and EXTERNAL").
+		EnumVar(&listServicesFilters.LaunchType, ecs.LaunchType_Values()...)
+	listServicesCommand.Flag("capacity-provider", "Only show services using this capacity provider").StringVar(&listServicesFilters.CapacityProvider)
+	listServicesCommand.Flag("tag", "Only show services whose tags match, as key=value, key!=value, key (tag exists) or !key (tag does not exist). Can be repeated").
+		StringsVar(&flagTags)
+	listServicesCommand.Flag("tag-column", "Add a column with the value of this tag. Can be repeated").StringsVar(&flagTagColumns)
+	listServicesCommand.Flag("sort", "Comma-separated keys to sort by, prefixed with - for descending order. Keys are "+strings.Join(SortKeyNames(ServiceSortKeys), ", ")).
+		Default("name").StringVar(&listServicesSort)
+	listServicesCommand.Flag("columns", "Comma-separated columns to show, in order. Columns are "+strings.Join(ColumnNames(ServiceColumns("", "")), ", ")).
+		StringVar(&flagColumns)
+	listServicesCommand.Flag("output", "Table layout. The options are: table, wide. wide adds the launch type, task definition, deployments, created time, ARN and link columns").
+		Short('o').Default("table").EnumVar(&flagOutput, "table", "wide")
+	listServicesCommand.Action(func(*kingpin.ParseContext) error {
+		var err error
+		listServicesFilters.Tags, err = ParseTagSelectors(flagTags)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --tag")
+		}
+		sorter, err := ParseSort(listServicesSort, ServiceSortKeys)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --sort")
+		}
+		filter, err := NewServiceFilter(listServicesFilters)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --regex")
+		}
+		allColumns := ServiceColumns(AWSRegion, argClusterName)
+		columns, err := SelectColumns(allColumns, SplitList(flagColumns), flagOutput == "wide")
+		if err != nil {
+			return InvalidInputError(err, "Invalid --columns")
+		}
+		columns = append(columns, TagColumns(flagTagColumns, func(s *ecs.Service) []*ecs.Tag { return s.Tags })...)
+		if listServicesShowLink && flagOutput != "wide" {
+			columns = append(columns, allColumns[len(allColumns)-1])
+		}
 		fmt.Fprint(os.Stderr, "Found 0 services")
-		err := svc.ListServicesPages(&ecs.ListServicesInput{Cluster: &argClusterName},
-			func(page *ecs.ListServicesOutput, lastPage bool) bool {
-				result, err := svc.DescribeServices(&ecs.DescribeServicesInput{
-					Cluster:  &argClusterName,
-					Services: page.ServiceArns,
-				})
-				app.FatalIfError(err, "Could not describe services")
-				services.Failures = append(services.Failures, result.Failures...)
-				services.Services = append(services.Services, result.Services...)
-				fmt.Fprintf(os.Stderr, "\rFound %v services", len(services.Services))
-				return true
-			})
+		services, err := listServices(ctx, svc, argClusterName, func(n int) {
+			fmt.Fprintf(os.Stderr, "\rFound %v services", n)
+		})
 		fmt.Fprint(os.Stderr, "\n")
-		app.FatalIfError(err, "Could list services")
-		ServiceSlice(services.Services).Sort()
-		table := tablewriter.NewWriter(os.Stdout)
-		header := []string{"Service Name", "Status", "Desired", "Running", "Pending"}
-		if listServicesShowLink {
-			header = append(header, "Link")
+		interrupted := Interrupted(ctx, err)
+		if interrupted {
+			WarnPartialResults(os.Stderr, ctx)
+		} else if err != nil {
+			return WrapError(err, "Could not list services")
 		}
-		table.SetHeader(header)
+		sorter.Sort(services.Services)
+		matched := []*ecs.Service{}
 		for _, service := range services.Services {
-			if !strings.Contains(*service.ServiceName, listServicesFilter) {
-				continue
+			if filter(service) {
+				matched = append(matched, service)
 			}
-			row := []string{
-				*service.ServiceName,
-				*service.Status,
-				strconv.FormatInt(*service.DesiredCount, 10),
-				strconv.FormatInt(*service.RunningCount, 10),
-				strconv.FormatInt(*service.PendingCount, 10),
-			}
-			if listServicesShowLink {
-				row = append(row, ServiceLink(AWSRegion, argClusterName, *service.ServiceName))
-			}
-			table.Append(row)
 		}
-		table.Render()
+		RenderTable(os.Stdout, columns, matched)
 		PrintFailures(services.Failures)
-		return nil
+		if interrupted {
+			return InterruptedError(ctx)
+		}
+		return FailuresError(services.Failures, "services")
 	})
 	var (
 		argServiceName            string
 		describeServiceShowEvents bool
+		describeServiceMetrics    bool
+		metricsWindow             time.Duration
 	)
 	describeServiceCommand := app.Command("service", "Show details of a service")
+	RequirePermissions(describeServiceCommand,
+		"ecs:DescribeServices", "ecs:DescribeTaskDefinition", "ecs:ListTasks", "ecs:DescribeTasks",
+		"ecs:DescribeContainerInstances",
+		"elasticloadbalancing:DescribeTargetGroups", "elasticloadbalancing:DescribeTargetHealth",
+		"elasticloadbalancing:DescribeListeners", "elasticloadbalancing:DescribeRules",
+		"application-autoscaling:DescribeScalableTargets", "application-autoscaling:DescribeScalingPolicies",
+		"application-autoscaling:DescribeScheduledActions", "application-autoscaling:DescribeScalingActivities",
+		"cloudwatch:GetMetricData",
+		"servicediscovery:GetService", "servicediscovery:GetNamespace",
+		"servicediscovery:ListInstances", "servicediscovery:GetInstancesHealthStatus",
+	)
 	describeServiceCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
 	describeServiceCommand.Arg("service", "Name of the service. This can be the full AWS service name, or the short one without the service- prefix and -<cluster> suffix").
 		Required().StringVar(&argServiceName)
-	describeServiceCommand.Flag("events", "Print service events").BoolVar(&describeServiceShowEvents)
-	describeServiceCommand.Action(func(ctx *kingpin.ParseContext) error {
-		result, err := svc.DescribeServices(&ecs.DescribeServicesInput{
-			Cluster:  &argClusterName,
-			Services: []*string{aws.String(FormatServiceName(argClusterName, argServiceName))},
-		})
-		app.FatalIfError(err, "Could not describe service")
-		if len(result.Services) == 0 {
-			app.Fatalf("Could not describe service")
+	describeServiceCommand.Flag("events", "Print service events, including auto scaling activities").BoolVar(&describeServiceShowEvents)
+	describeServiceCommand.Flag("metrics", "Print CPU and memory utilization, and Container Insights metrics when enabled").BoolVar(&describeServiceMetrics)
+	describeServiceCommand.Flag("window", "How far back to fetch metrics for").Default("1h").DurationVar(&metricsWindow)
+	describeServiceCommand.Action(func(*kingpin.ParseContext) error {
+		if describeServiceMetrics && metricsWindow <= 0 {
+			return NewError(KindInvalidInput, "Invalid --window: %v must be positive", metricsWindow)
+		}
+		service, err := getServiceDetail(ctx, svc, argClusterName, argServiceName)
+		if err != nil {
+			return WrapError(err, "Could not describe service")
 		}
-		service := result.Services[0]
 		fmt.Println("Service")
-		table := tablewriter.NewWriter(os.Stdout)
+		table := NewTable(os.Stdout)
 		table.SetAlignment(tablewriter.ALIGN_LEFT)
 		rows := [][]string{
 			{"Name", *service.ServiceName},
@@ -158,29 +346,49 @@ func main() {
 			{"Desired Count", strconv.FormatInt(*service.DesiredCount, 10)},
 			{"Running Count", strconv.FormatInt(*service.RunningCount, 10)},
 			{"Pending Count", strconv.FormatInt(*service.PendingCount, 10)},
-			{"Service Link", ServiceLink(AWSRegion, argClusterName, *service.ServiceName)},
-			{"Task Definition Link", TaskDefinitionLink(AWSRegion, ParseARN(*service.TaskDefinition))},
-		}
-		table.AppendBulk(rows)
-		if len(service.LoadBalancers) > 0 {
-			lb := service.LoadBalancers[0]
-			table.Append([]string{"LB Container Name", *lb.ContainerName})
-			table.Append([]string{"LB Container Port", strconv.FormatInt(*lb.ContainerPort, 10)})
+			{"Service Link", ecsq.ServiceLink(AWSRegion, argClusterName, *service.ServiceName)},
+			{"Task Definition Link", ecsq.TaskDefinitionLink(AWSRegion, ecsq.ParseARN(*service.TaskDefinition))},
 		}
+		table.AppendBulk(FitRows(nil, rows, TerminalWidth()))
 		table.Render()
-		tdr, err := svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		loadBalancers, err := GetServiceLoadBalancers(ctx, svc, elbv2.New(sess), argClusterName, service)
+		if err != nil {
+			if err := SkipSection(ctx, os.Stderr, "load balancers", err); err != nil {
+				return err
+			}
+		}
+		RenderServiceLoadBalancers(os.Stdout, loadBalancers)
+		scaling, err := GetServiceAutoScaling(ctx, applicationautoscaling.New(sess), service)
+		if err != nil {
+			if err := SkipSection(ctx, os.Stderr, "auto scaling", err); err != nil {
+				return err
+			}
+		}
+		RenderServiceAutoScaling(os.Stdout, scaling)
+		discovery, err := GetServiceDiscovery(ctx, NewCloudMap(servicediscovery.New(sess)), service, true)
+		if err != nil {
+			if err := SkipSection(ctx, os.Stderr, "service discovery", err); err != nil {
+				return err
+			}
+		}
+		RenderServiceDiscovery(os.Stdout, discovery)
+		tdr, err := svc.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 			TaskDefinition: service.TaskDefinition,
 		})
-		app.FatalIfError(err, "Could not describe task definition")
+		if err != nil {
+			return WrapError(err, "Could not describe task definition")
+		}
 		fmt.Println("Containers")
-		table = tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Name", "Image", "CPU", "Memory", "Command"})
+		table = NewTable(os.Stdout)
+		header := []string{"Name", "Image", "CPU", "Memory", "Command"}
+		table.SetHeader(header)
+		rows = [][]string{}
 		for _, container := range tdr.TaskDefinition.ContainerDefinitions {
 			command := []string{}
 			for _, piece := range container.Command {
 				command = append(command, *piece)
 			}
-			table.Append([]string{
+			rows = append(rows, []string{
 				*container.Name,
 				*container.Image,
 				strconv.FormatInt(aws.Int64Value(container.Cpu), 10),
@@ -188,10 +396,25 @@ func main() {
 				strings.Join(command, " "),
 			})
 		}
+		table.AppendBulk(FitRows(header, rows, TerminalWidth()))
 		table.Render()
 
+		if describeServiceMetrics {
+			metrics := append(append([]ServiceMetric{}, ServiceUtilizationMetrics...), ContainerInsightsMetrics...)
+			series, err := GetServiceMetrics(ctx, cloudwatch.New(sess), ecsq.ParseARN(*service.ClusterArn).Name, []string{*service.ServiceName}, metrics, metricsWindow)
+			if err != nil {
+				return WrapError(err, "Could not get metrics")
+			}
+			fmt.Printf("Metrics (last %v)\n", metricsWindow)
+			RenderMetricSeries(os.Stdout, series[*service.ServiceName])
+		}
+
 		if describeServiceShowEvents {
-			ServiceEventSlice(service.Events).Sort()
+			events := service.Events
+			if scaling != nil {
+				events = append(events, ScalingActivityEvents(scaling.Activities)...)
+			}
+			MustParseSort("time", ServiceEventSortKeys).Sort(events)
 			tmpl := `
 Events:
 {{- range . }}
@@ -205,36 +428,96 @@ Events:
 				},
 			})
 			t, err := t.Parse(tmpl)
-			app.FatalIfError(err, "Failed to parse events template")
-			t.Execute(os.Stdout, service.Events)
+			if err != nil {
+				return WrapError(err, "Failed to parse events template")
+			}
+			t.Execute(os.Stdout, events)
 		}
 		return nil
 	})
 
 	var listTasksStatusFlag string
 	var listTasksRawFlag bool
+	var listTasksSortFlag string
 	listTasksCommand := app.Command("tasks", "List tasks belonging to a service")
+	RequirePermissions(listTasksCommand, "ecs:ListTasks", "ecs:DescribeTasks")
 	listTasksCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
 	listTasksCommand.Arg("service", "Name of the service. This can be the full AWS service name, or the short one without the service- prefix and -<cluster> suffix").
 		Required().StringVar(&argServiceName)
 	listTasksCommand.Flag("status", "Status of the service. The options are running, stopped, and all. Defaults to all").
 		Default("all").EnumVar(&listTasksStatusFlag, "all", "running", "stopped")
 	listTasksCommand.Flag("raw", "Show output in raw format, one task per line").BoolVar(&listTasksRawFlag)
-	listTasksCommand.Action(func(ctx *kingpin.ParseContext) error {
-		serviceName := FormatServiceName(argClusterName, argServiceName)
+	listTasksCommand.Flag("tag", "Only show tasks whose tags match, as key=value, key!=value, key (tag exists) or !key (tag does not exist). Can be repeated").
+		StringsVar(&flagTags)
+	listTasksCommand.Flag("tag-column", "Show the value of this tag next to each task. Can be repeated").StringsVar(&flagTagColumns)
+	listTasksCommand.Flag("sort", "Comma-separated keys to sort running and stopped tasks by, prefixed with - for descending order. Keys are "+strings.Join(SortKeyNames(TaskSortKeys), ", ")).
+		StringVar(&listTasksSortFlag)
+	listTasksCommand.Action(func(*kingpin.ParseContext) error {
+		selectors, err := ParseTagSelectors(flagTags)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --tag")
+		}
+		sorter, err := ParseSort(listTasksSortFlag, TaskSortKeys)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --sort")
+		}
+		serviceName, err := FormatServiceName(argClusterName, argServiceName)
+		if err != nil {
+			return InvalidInputError(err, "Invalid %v", ecsq.ServiceNameExpansionEnv)
+		}
 		var runningTasks, stoppedTasks []*string
-		var err error
+		// On Ctrl-C or --timeout, the tasks found so far are still printed.
+		interrupted := false
 		if listTasksStatusFlag == "all" || listTasksStatusFlag == "running" {
-			runningTasks, err = getTasksArns(svc, argClusterName, serviceName, ecs.DesiredStatusRunning)
+			runningTasks, err = getTasksArns(ctx, svc, argClusterName, serviceName, ecs.DesiredStatusRunning)
+			interrupted = Interrupted(ctx, err)
+		}
+		if !interrupted && err != nil {
+			return WrapError(err, "Could not list tasks")
+		}
+		if !interrupted && (listTasksStatusFlag == "all" || listTasksStatusFlag == "stopped") {
+			stoppedTasks, err = getTasksArns(ctx, svc, argClusterName, serviceName, ecs.DesiredStatusStopped)
+			interrupted = Interrupted(ctx, err)
 		}
-		app.FatalIfError(err, "Could not list tasks")
-		if listTasksStatusFlag == "all" || listTasksStatusFlag == "stopped" {
-			stoppedTasks, err = getTasksArns(svc, argClusterName, serviceName, ecs.DesiredStatusStopped)
+		if !interrupted && err != nil {
+			return WrapError(err, "Could not list tasks")
+		}
+		taskTags := map[string][]*ecs.Tag{}
+		if !interrupted && (len(selectors) > 0 || len(flagTagColumns) > 0 || len(sorter) > 0) {
+			described, err := describeTasks(ctx, svc, argClusterName, append(append([]*string{}, runningTasks...), stoppedTasks...))
+			interrupted = Interrupted(ctx, err)
+			if !interrupted && err != nil {
+				return WrapError(err, "Could not describe tasks")
+			}
+			tasksByArn := map[string]*ecs.Task{}
+			for _, task := range described.Tasks {
+				tasksByArn[*task.TaskArn] = task
+				taskTags[*task.TaskArn] = task.Tags
+			}
+			filterAndSort := func(arns []*string) []*string {
+				tasks := []*ecs.Task{}
+				for _, arn := range arns {
+					if task, ok := tasksByArn[*arn]; ok && MatchTags(selectors, task.Tags) {
+						tasks = append(tasks, task)
+					}
+				}
+				sorter.Sort(tasks)
+				filtered := []*string{}
+				for _, task := range tasks {
+					filtered = append(filtered, task.TaskArn)
+				}
+				return filtered
+			}
+			runningTasks, stoppedTasks = filterAndSort(runningTasks), filterAndSort(stoppedTasks)
+		}
+		var partialErr error
+		if interrupted {
+			WarnPartialResults(os.Stderr, ctx)
+			partialErr = InterruptedError(ctx)
 		}
-		app.FatalIfError(err, "Could not list tasks")
 		if len(runningTasks) == 0 && len(stoppedTasks) == 0 {
 			fmt.Println("No tasks found")
-			return nil
+			return partialErr
 		}
 
 		if listTasksRawFlag {
@@ -242,7 +525,7 @@ Events:
 			for _, task := range tasks {
 				fmt.Println(*task)
 			}
-			return nil
+			return partialErr
 		}
 		var exampleTask *string
 		if len(runningTasks) > 0 {
@@ -253,20 +536,31 @@ Events:
 		tmpl := `
 Running Tasks:
 {{- range .RunningTasks }}
-	{{.}}
+	{{formatTask .}}
 {{- end }}
 
 Stopped Tasks:
 {{- range .StoppedTasks }}
-	{{.}}
+	{{formatTask .}}
 {{- end }}
 
 Use the "task" command to get details of a task. For example:
 	ecsq task {{.Cluster}} {{.ExampleTask}}
 `
 		t := template.New("list-tasks")
+		t.Funcs(template.FuncMap{
+			"formatTask": func(arn *string) string {
+				line := *arn
+				for i, value := range TagValues(taskTags[*arn], flagTagColumns) {
+					line += fmt.Sprintf(" %v=%v", flagTagColumns[i], value)
+				}
+				return line
+			},
+		})
 		t, err = t.Parse(tmpl)
-		app.FatalIfError(err, "Could not parse task list template")
+		if err != nil {
+			return WrapError(err, "Could not parse task list template")
+		}
 		err = t.Execute(os.Stdout, struct {
 			Cluster      string
 			RunningTasks []*string
@@ -278,69 +572,94 @@ Use the "task" command to get details of a task. For example:
 			StoppedTasks: stoppedTasks,
 			ExampleTask:  exampleTask,
 		})
-		app.FatalIfError(err, "Could not print tasks")
-		return nil
+		if err != nil {
+			return WrapError(err, "Could not print tasks")
+		}
+		return partialErr
 	})
 	var argTaskID string
 	describeTaskCommand := app.Command("task", "Describe the given task. If a service name is provided instead, describes an arbitrary task for that service.")
+	RequirePermissions(describeTaskCommand,
+		"ecs:ListTasks", "ecs:DescribeTasks", "ecs:DescribeContainerInstances",
+		"ec2:DescribeInstances",
+	)
 	describeTaskCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
 	describeTaskCommand.Arg("task or service", "ID or ARN of the task or name of service").Required().StringVar(&argTaskID)
-	describeTaskCommand.Action(func(ctx *kingpin.ParseContext) error {
-		if !isTaskARN(argTaskID) && !isTaskID(argTaskID) {
+	describeTaskCommand.Action(func(*kingpin.ParseContext) error {
+		if !ecsq.IsTaskARN(argTaskID) && !ecsq.IsTaskID(argTaskID) {
 			fmt.Println("Invalid task ID, assuming this is a service name. Looking up arbitrary task for service")
-			serviceName := FormatServiceName(argClusterName, argTaskID)
-			taskArns, err := getTasksArns(svc, argClusterName, serviceName, "RUNNING")
+		}
+		taskArn, err := resolveTask(ctx, svc, argClusterName, argTaskID)
+		if err != nil {
+			return WrapError(err, "Could not find task")
+		}
+		task, err := getTaskDetail(ctx, svc, argClusterName, taskArn)
+		if err != nil {
+			return WrapError(err, "Could not describe task")
+		}
+		// Fargate tasks don't run on a container instance, so there is no EC2 instance to describe.
+		var (
+			containerInstance *ecs.ContainerInstance
+			ec2Instance       *ec2.Instance
+		)
+		if task.ContainerInstanceArn != nil {
+			containerInstanceResult, err := svc.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+				Cluster:            &argClusterName,
+				ContainerInstances: []*string{task.ContainerInstanceArn},
+			})
 			if err != nil {
-				fmt.Println("Error listing tasks", err)
-				return nil
+				return WrapError(err, "Could not describe task container instance")
 			}
-			if len(taskArns) == 0 {
-				fmt.Println("No tasks found for service ", serviceName)
-				return nil
+			if len(containerInstanceResult.Failures) > 0 {
+				return WrapError(ecsq.NewFailureError(containerInstanceResult.Failures[0]), "Could not describe task container instance")
+			}
+			if len(containerInstanceResult.ContainerInstances) == 0 {
+				return NewError(KindNotFound, "Could not find container instance %v", *task.ContainerInstanceArn)
 			}
-			argTaskID = *taskArns[0]
-		}
-		task, err := getTaskDetail(svc, argClusterName, argTaskID)
-		app.FatalIfError(err, "Could not describe task")
-		containerInstanceResult, err := svc.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
-			Cluster:            &argClusterName,
-			ContainerInstances: []*string{task.ContainerInstanceArn},
-		})
-		var containerInstance *ecs.ContainerInstance
-		app.FatalIfError(err, "Could not describe task container instance")
-		if len(containerInstanceResult.Failures) > 0 {
-			PrintFailures(containerInstanceResult.Failures)
-			app.Fatalf("Could not describe task container instance")
-		} else if len(containerInstanceResult.ContainerInstances) > 0 {
 			containerInstance = containerInstanceResult.ContainerInstances[0]
 		}
-		svc := ec2.New(sess, &config)
-		ec2Result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
-			InstanceIds: []*string{containerInstance.Ec2InstanceId},
-		})
-		app.FatalIfError(err, "Could not get EC2 instance")
-		if len(ec2Result.Reservations) == 0 || len(ec2Result.Reservations[0].Instances) == 0 {
-			app.Fatalf("Could not find EC2 instance %v", containerInstance.Ec2InstanceId)
+		if containerInstance != nil && containerInstance.Ec2InstanceId != nil {
+			svc := ec2.New(sess, &config)
+			ec2Result, err := svc.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+				InstanceIds: []*string{containerInstance.Ec2InstanceId},
+			})
+			if err != nil {
+				return WrapError(err, "Could not get EC2 instance")
+			}
+			if len(ec2Result.Reservations) == 0 || len(ec2Result.Reservations[0].Instances) == 0 {
+				return NewError(KindNotFound, "Could not find EC2 instance %v", *containerInstance.Ec2InstanceId)
+			}
+			ec2Instance = ec2Result.Reservations[0].Instances[0]
 		}
-		ec2Instance := ec2Result.Reservations[0].Instances[0]
 
-		table := tablewriter.NewWriter(os.Stdout)
-		taskID := ParseARN(*task.TaskArn).Name
-		taskDefinitionARN := ParseARN(*task.TaskDefinitionArn)
-		containerInstanceID := ParseARN(*task.ContainerInstanceArn).Name
+		table := NewTable(os.Stdout)
+		taskID := ecsq.ParseARN(*task.TaskArn).Name
+		taskDefinitionARN := ecsq.ParseARN(*task.TaskDefinitionArn)
 		rows := [][]string{
 			{"Task ID", taskID},
 			{"Task ARN", *task.TaskArn},
 			{"Task Definition", *task.TaskDefinitionArn},
-			{"Container Instance", containerInstanceID},
-			{"EC2 Instance", *containerInstance.Ec2InstanceId},
-			{"EC2 Instance Private IP", *ec2Instance.PrivateIpAddress},
-			{"Task Link", TaskLink(AWSRegion, argClusterName, taskID)},
-			{"Task Definition Link", TaskDefinitionLink(AWSRegion, taskDefinitionARN)},
-			{"Container Instance Link", ContainerInstanceLink(AWSRegion, argClusterName, containerInstanceID)},
-			{"EC2 Instance Link", EC2InstanceLink(AWSRegion, *containerInstance.Ec2InstanceId)},
-		}
-		table.AppendBulk(rows)
+		}
+		if containerInstance != nil {
+			rows = append(rows, []string{"Container Instance", ecsq.ParseARN(*task.ContainerInstanceArn).Name})
+		}
+		if ec2Instance != nil {
+			rows = append(rows,
+				[]string{"EC2 Instance", *ec2Instance.InstanceId},
+				[]string{"EC2 Instance Private IP", aws.StringValue(ec2Instance.PrivateIpAddress)},
+			)
+		}
+		rows = append(rows,
+			[]string{"Task Link", ecsq.TaskLink(AWSRegion, argClusterName, taskID)},
+			[]string{"Task Definition Link", ecsq.TaskDefinitionLink(AWSRegion, taskDefinitionARN)},
+		)
+		if containerInstance != nil {
+			rows = append(rows, []string{"Container Instance Link", ecsq.ContainerInstanceLink(AWSRegion, argClusterName, ecsq.ParseARN(*task.ContainerInstanceArn).Name)})
+		}
+		if ec2Instance != nil {
+			rows = append(rows, []string{"EC2 Instance Link", ecsq.EC2InstanceLink(AWSRegion, *ec2Instance.InstanceId)})
+		}
+		table.AppendBulk(FitRows(nil, rows, TerminalWidth()))
 		fmt.Println("Details:")
 		table.Render()
 
@@ -364,7 +683,10 @@ Use the "task" command to get details of a task. For example:
 					"Network - Container Port",
 					strconv.FormatInt(*network.ContainerPort, 10),
 				})
-				link := *ec2Instance.PrivateIpAddress
+				if ec2Instance == nil || network.HostPort == nil {
+					continue
+				}
+				link := aws.StringValue(ec2Instance.PrivateIpAddress)
 				link += ":" + strconv.FormatInt(*network.HostPort, 10)
 				table.Append([]string{
 					*container.Name,
@@ -380,28 +702,36 @@ Use the "task" command to get details of a task. For example:
 		flagContainerName string
 		flagFormat        string
 		flagDrop          string
+		containerEnvSort  string
 	)
 	containerEnvCommand := app.Command("container-env", "List environment variables for the task's container. Use --format to choose the output format")
+	RequirePermissions(containerEnvCommand, "ecs:DescribeServices", "ecs:DescribeTaskDefinition")
 	containerEnvCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
 	containerEnvCommand.Arg("service", "Name of the service. This can be the full AWS service name, or the short one without the service- prefix and -<cluster> suffix").Required().StringVar(&argServiceName)
 	containerEnvCommand.Flag("container", "Name of the container").StringVar(&flagContainerName)
 	containerEnvCommand.Flag("format", "Format to render the environment variable in. The options are: export, shell, docker, table. Defaults to table").
 		Default("table").EnumVar(&flagFormat, "export", "shell", "docker", "table")
 	containerEnvCommand.Flag("drop", "Case-insensitive comma-separated list of variable names to drop").OverrideDefaultFromEnvar("ECSQ_DROP_ENV_VARS").StringVar(&flagDrop)
-	containerEnvCommand.Action(func(ctx *kingpin.ParseContext) error {
-		task, err := getServiceDetail(svc, argClusterName, argServiceName)
-		app.FatalIfError(err, "Could not describe service")
-		result, err := svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+	containerEnvCommand.Flag("sort", "Comma-separated keys to sort by, prefixed with - for descending order. Keys are "+strings.Join(SortKeyNames(KeyValuePairSortKeys), ", ")).
+		Default("name").StringVar(&containerEnvSort)
+	containerEnvCommand.Action(func(*kingpin.ParseContext) error {
+		task, err := getServiceDetail(ctx, svc, argClusterName, argServiceName)
+		if err != nil {
+			return WrapError(err, "Could not describe service")
+		}
+		result, err := svc.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 			TaskDefinition: task.TaskDefinition,
 		})
-		app.FatalIfError(err, "Could not describe task definition")
+		if err != nil {
+			return WrapError(err, "Could not describe task definition")
+		}
 		taskDefinition := result.TaskDefinition
 		var containerDefinition *ecs.ContainerDefinition
 		if flagContainerName == "" && len(taskDefinition.ContainerDefinitions) > 1 {
 			for _, c := range taskDefinition.ContainerDefinitions {
 				fmt.Println("*", *c.Name)
 			}
-			app.Fatalf("Multiple containers found, choose one by name by setting --container")
+			return NewError(KindInvalidInput, "Multiple containers found, choose one by name by setting --container")
 		} else if flagContainerName == "" && len(taskDefinition.ContainerDefinitions) == 1 {
 			containerDefinition = taskDefinition.ContainerDefinitions[0]
 		} else {
@@ -413,9 +743,13 @@ Use the "task" command to get details of a task. For example:
 			}
 		}
 		if containerDefinition == nil {
-			app.Fatalf("Container not found")
+			return NewError(KindNotFound, "Container %v not found", flagContainerName)
 		}
-		KeyValuePairSlice(containerDefinition.Environment).Sort()
+		sorter, err := ParseSort(containerEnvSort, KeyValuePairSortKeys)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --sort")
+		}
+		sorter.Sort(containerDefinition.Environment)
 
 		if flagDrop != "" {
 			filters := map[string]bool{}
@@ -457,152 +791,495 @@ Use the "task" command to get details of a task. For example:
 			}
 			fmt.Println(envStr)
 		} else {
-			app.Fatalf("Invalid format %v", flagFormat)
+			return NewError(KindInvalidInput, "Invalid format %v", flagFormat)
 		}
 		return nil
 	})
-	kingpin.MustParse(app.Parse(os.Args[1:]))
-}
-
-// ARN contains the pieces of an AWS ARN
-type ARN struct {
-	Type     string
-	Name     string
-	Instance string
-}
-
-// ParseARN breaks a raw AWS ARN string into its pieces and returns an instance of the ARN struct
-func ParseARN(s string) *ARN {
-	arn := &ARN{}
-	pieces := strings.Split(s, ":")
-	typeName := strings.SplitN(pieces[5], "/", 2)
-	arn.Type = typeName[0]
-	if len(typeName) >= 2 {
-		arn.Name = typeName[1]
+	var (
+		argOtherClusterName string
+		driftOutputFlag     string
+	)
+	driftCommand := app.Command("drift", "Compare the configuration of services between two clusters. Exits non-zero if there are differences")
+	RequirePermissions(driftCommand, "ecs:ListServices", "ecs:DescribeServices", "ecs:DescribeTaskDefinition")
+	driftCommand.Arg("cluster-a", "Name or ARN of the first cluster. Prefix a name with <region>: to use a cluster in another region").Required().StringVar(&argClusterName)
+	driftCommand.Arg("cluster-b", "Name or ARN of the second cluster. Prefix a name with <region>: to use a cluster in another region").Required().StringVar(&argOtherClusterName)
+	driftCommand.Flag("output", "Format to render the report in. The options are: table, json. Defaults to table").
+		Short('o').Default("table").EnumVar(&driftOutputFlag, "table", "json")
+	driftCommand.Action(func(*kingpin.ParseContext) error {
+		refs := []ClusterRef{}
+		for _, name := range []string{argClusterName, argOtherClusterName} {
+			ref, err := ParseClusterRef(name, AWSRegion)
+			if err != nil {
+				return InvalidInputError(err, "Invalid cluster")
+			}
+			refs = append(refs, ref)
+		}
+		configs := make([][]*ServiceConfig, len(refs))
+		for i, ref := range refs {
+			client := svc
+			if ref.Region != AWSRegion {
+				client = ecs.New(sess, aws.NewConfig().WithRegion(ref.Region))
+			}
+			var err error
+			configs[i], err = getServiceConfigs(ctx, client, ref.Cluster)
+			if err != nil {
+				return WrapError(err, "Could not describe services in %v", ref)
+			}
+		}
+		report := &DriftReport{
+			A:           refs[0].String(),
+			B:           refs[1].String(),
+			Differences: CompareServiceConfigs(configs[0], configs[1]),
+		}
+		if err := RenderDriftReport(os.Stdout, report, driftOutputFlag); err != nil {
+			return WrapError(err, "Could not render drift report")
+		}
+		if len(report.Differences) > 0 {
+			exitCode = ExitFindings
+		}
+		return nil
+	})
+	var snapshotOutputFile string
+	snapshotCommand := app.Command("snapshot", "Capture the cluster, its services, deployments, task definitions and running tasks as JSON")
+	RequirePermissions(snapshotCommand,
+		"ecs:DescribeClusters", "ecs:ListServices", "ecs:DescribeServices", "ecs:DescribeTaskDefinition", "ecs:ListTasks", "ecs:DescribeTasks",
+	)
+	snapshotCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	snapshotCommand.Flag("output", "File to write the snapshot to. Defaults to stdout").Short('o').StringVar(&snapshotOutputFile)
+	snapshotCommand.Action(func(*kingpin.ParseContext) error {
+		snapshot, err := TakeSnapshot(ctx, svc, AWSRegion, argClusterName)
+		if err != nil {
+			return WrapError(err, "Could not snapshot cluster")
+		}
+		out := os.Stdout
+		if snapshotOutputFile != "" {
+			out, err = os.Create(snapshotOutputFile)
+			if err != nil {
+				return WrapError(err, "Could not create snapshot file")
+			}
+			defer out.Close()
+		}
+		if err := WriteSnapshot(out, snapshot); err != nil {
+			return WrapError(err, "Could not write snapshot")
+		}
+		if snapshotOutputFile != "" {
+			fmt.Fprintf(os.Stderr, "Wrote snapshot of %v services to %v\n", len(snapshot.Services), snapshotOutputFile)
+		}
+		return nil
+	})
+	var (
+		argSnapshotBefore      string
+		argSnapshotAfter       string
+		snapshotDiffOutputFlag string
+	)
+	snapshotDiffCommand := app.Command("snapshot-diff", "Show what changed between two snapshots taken with the snapshot command")
+	RequirePermissions(snapshotDiffCommand)
+	snapshotDiffCommand.Arg("before", "Path to the older snapshot").Required().ExistingFileVar(&argSnapshotBefore)
+	snapshotDiffCommand.Arg("after", "Path to the newer snapshot").Required().ExistingFileVar(&argSnapshotAfter)
+	snapshotDiffCommand.Flag("output", "Format to render the changes in. The options are: table, json. Defaults to table").
+		Short('o').Default("table").EnumVar(&snapshotDiffOutputFlag, "table", "json")
+	snapshotDiffCommand.Action(func(*kingpin.ParseContext) error {
+		before, err := ReadSnapshotFile(argSnapshotBefore)
+		if err != nil {
+			return WrapError(err, "Could not read snapshot")
+		}
+		after, err := ReadSnapshotFile(argSnapshotAfter)
+		if err != nil {
+			return WrapError(err, "Could not read snapshot")
+		}
+		changes := DiffSnapshots(before, after)
+		if err := RenderSnapshotChanges(os.Stdout, before, after, changes, snapshotDiffOutputFlag); err != nil {
+			return WrapError(err, "Could not render changes")
+		}
+		return nil
+	})
+	var (
+		doctorOptions    = DefaultDoctorOptions
+		doctorOutputFlag string
+	)
+	doctorCommand := app.Command("doctor", "Check the cluster for problems with services, deployments, container instances and tasks. Exits non-zero if there are critical problems")
+	RequirePermissions(doctorCommand,
+		"ecs:ListServices", "ecs:DescribeServices", "ecs:ListContainerInstances", "ecs:DescribeContainerInstances", "ecs:ListTasks", "ecs:DescribeTasks",
+	)
+	doctorCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	doctorCommand.Flag("stuck-after", "How long a deployment can be in progress before it is reported as stuck").
+		Default(doctorOptions.StuckDeploymentAge.String()).DurationVar(&doctorOptions.StuckDeploymentAge)
+	doctorCommand.Flag("window", "How far back to look at service events").
+		Default(doctorOptions.EventWindow.String()).DurationVar(&doctorOptions.EventWindow)
+	doctorCommand.Flag("output", "Format to render the findings in. The options are: table, json. Defaults to table").
+		Short('o').Default("table").EnumVar(&doctorOutputFlag, "table", "json")
+	doctorCommand.Action(func(*kingpin.ParseContext) error {
+		state, err := GetClusterState(ctx, svc, argClusterName)
+		if err != nil {
+			return WrapError(err, "Could not describe cluster")
+		}
+		findings := RunDoctor(state, doctorOptions)
+		if err := RenderFindings(os.Stdout, findings, doctorOutputFlag); err != nil {
+			return WrapError(err, "Could not render findings")
+		}
+		if HasCritical(findings) {
+			exitCode = ExitFindings
+		}
+		return nil
+	})
+	var (
+		execContainer string
+		execCommand   []string
+	)
+	execCommandCmd := app.Command("exec", "Run a command in a container of a task with ECS Exec. If a service name is provided instead of a task, uses an arbitrary running task of the service")
+	RequirePermissions(execCommandCmd, "ecs:ListTasks", "ecs:DescribeTasks", "ecs:ExecuteCommand")
+	execCommandCmd.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	execCommandCmd.Arg("task or service", "ID or ARN of the task or name of service").Required().StringVar(&argTaskID)
+	execCommandCmd.Arg("command", "Command to run, after --. Defaults to /bin/sh").Default("/bin/sh").StringsVar(&execCommand)
+	execCommandCmd.Flag("container", "Name of the container. Required if the task has more than one container").Short('c').StringVar(&execContainer)
+	execCommandCmd.Action(func(*kingpin.ParseContext) error {
+		plugin, err := NewSessionManagerPlugin()
+		if err != nil {
+			return WrapError(err, "Could not start session")
+		}
+		err = ExecuteCommand(ctx, svc, plugin, AWSRegion, argClusterName, argTaskID, execContainer, execCommand)
+		if err != nil {
+			return WrapError(err, "Could not execute command")
+		}
+		return nil
+	})
+	selfCommand := app.Command("self", "Describe the task ecsq is running in, from the ECS task metadata endpoint")
+	RequirePermissions(selfCommand, "ecs:DescribeTasks")
+	selfCommand.Action(func(*kingpin.ParseContext) error {
+		client, err := NewMetadataClientFromEnv()
+		if err != nil {
+			return WrapError(err, "Could not find the task metadata endpoint")
+		}
+		task, err := client.Task(ctx)
+		if err != nil {
+			return WrapError(err, "Could not read task metadata")
+		}
+		stats, err := client.Stats(ctx)
+		if err != nil {
+			return WrapError(err, "Could not read task stats")
+		}
+		links, err := GetTaskLinks(ctx, ecs.New(sess, aws.NewConfig().WithRegion(task.TaskRegion())), task)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not describe the task with the ECS API, some links are missing:", err)
+		}
+		RenderTaskMetadata(os.Stdout, task, stats, links)
+		return nil
+	})
+	var argWhoisQuery string
+	whoisCommand := app.Command("whois", "Find the task, container or container instance behind an IP address, IP:port or EC2 instance ID")
+	RequirePermissions(whoisCommand,
+		"ecs:ListTasks", "ecs:DescribeTasks", "ecs:ListContainerInstances", "ecs:DescribeContainerInstances",
+		"ec2:DescribeInstances",
+	)
+	whoisCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	whoisCommand.Arg("address", "IP address, IP:port or EC2 instance ID, e.g. 10.0.12.34:32768 or i-0a1b2c3d4e5f67890").Required().StringVar(&argWhoisQuery)
+	whoisCommand.Action(func(*kingpin.ParseContext) error {
+		query, err := ParseWhoisQuery(argWhoisQuery)
+		if err != nil {
+			return InvalidInputError(err, "Invalid address")
+		}
+		tasks, hosts, err := GetWhoisCandidates(ctx, svc, ec2.New(sess, &config), argClusterName)
+		if err != nil {
+			return WrapError(err, "Could not describe cluster")
+		}
+		matches := FindWhois(query, tasks, hosts)
+		if len(matches) == 0 {
+			return NewError(KindNotFound, "No running task or container instance in %v matches %v", argClusterName, query)
+		}
+		RenderWhoisMatches(os.Stdout, AWSRegion, argClusterName, matches)
+		return nil
+	})
+	var (
+		eventsServices []string
+		eventsSince    string
+		eventsUntil    string
+		eventsGrep     string
+		eventsFollow   bool
+		eventsInterval time.Duration
+		eventsGroup    bool
+	)
+	eventsCommand := app.Command("events", "Show the events of every service in the cluster as one timeline")
+	RequirePermissions(eventsCommand, "ecs:ListServices", "ecs:DescribeServices")
+	eventsCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	eventsCommand.Arg("service", "Only show events of services whose full or short name starts with one of these prefixes").StringsVar(&eventsServices)
+	eventsCommand.Flag("since", "Only show events after this time, as a duration before now like 2h, or an RFC 3339 time").StringVar(&eventsSince)
+	eventsCommand.Flag("until", "Only show events before this time, as a duration before now like 30m, or an RFC 3339 time. With --follow, stop following once it has passed").StringVar(&eventsUntil)
+	eventsCommand.Flag("grep", "Only show events whose message matches this regular expression").StringVar(&eventsGrep)
+	eventsCommand.Flag("follow", "Keep polling for new events").Short('f').BoolVar(&eventsFollow)
+	eventsCommand.Flag("interval", "How often to poll for new events with --follow. At least 1s").Default("15s").DurationVar(&eventsInterval)
+	eventsCommand.Flag("group", "Group repeated messages from the same service. Use --no-group to show every event").Default("true").BoolVar(&eventsGroup)
+	eventsCommand.Action(func(*kingpin.ParseContext) error {
+		now := time.Now()
+		filter := EventFilter{Services: eventsServices}
+		var err error
+		filter.Since, err = ParseEventTime(eventsSince, now)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --since")
+		}
+		filter.Until, err = ParseEventTime(eventsUntil, now)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --until")
+		}
+		if eventsGrep != "" {
+			filter.Grep, err = regexp.Compile(eventsGrep)
+			if err != nil {
+				return InvalidInputError(err, "Invalid --grep")
+			}
+		}
+		if eventsFollow {
+			if eventsInterval < MinFollowInterval {
+				return NewError(KindInvalidInput, "Invalid --interval: %v is shorter than %v", eventsInterval, MinFollowInterval)
+			}
+			// Polls must see new events, so never serve them from the cache.
+			cache.Refresh = true
+			// Following stops at Ctrl-C or --timeout, which is not an error.
+			if err := FollowServiceEvents(ctx, os.Stdout, svc, argClusterName, filter, eventsGroup, eventsInterval); !Interrupted(ctx, err) {
+				if err != nil {
+					return WrapError(err, "Could not list services")
+				}
+			}
+			return nil
+		}
+		services, err := listServices(ctx, svc, argClusterName, nil)
+		interrupted := Interrupted(ctx, err)
+		if interrupted {
+			WarnPartialResults(os.Stderr, ctx)
+		} else {
+			if err != nil {
+				return WrapError(err, "Could not list services")
+			}
+		}
+		events := MergeServiceEvents(argClusterName, services.Services, filter)
+		if eventsGroup {
+			events = GroupRepeatedEvents(events)
+		}
+		RenderClusterEvents(os.Stdout, events)
+		if interrupted {
+			return InterruptedError(ctx)
+		}
+		return nil
+	})
+	var (
+		topSort  string
+		topLimit int
+	)
+	topCommand := app.Command("top", "Show the CPU and memory utilization of every service in the cluster, busiest first")
+	RequirePermissions(topCommand, "ecs:ListServices", "ecs:DescribeServices", "cloudwatch:GetMetricData")
+	topCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	topCommand.Flag("window", "How far back to fetch metrics for").Default("1h").DurationVar(&metricsWindow)
+	topCommand.Flag("sort", "Comma-separated keys to sort by, prefixed with - for descending order. Keys are "+strings.Join(SortKeyNames(ServiceUtilizationSortKeys), ", ")).
+		Default("-cpu").StringVar(&topSort)
+	topCommand.Flag("limit", "Only show this many services. 0 shows all").Default("0").IntVar(&topLimit)
+	topCommand.Action(func(*kingpin.ParseContext) error {
+		if metricsWindow <= 0 {
+			return NewError(KindInvalidInput, "Invalid --window: %v must be positive", metricsWindow)
+		}
+		sorter, err := ParseSort(topSort, ServiceUtilizationSortKeys)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --sort")
+		}
+		services, err := listServices(ctx, svc, argClusterName, nil)
+		if err != nil {
+			return WrapError(err, "Could not list services")
+		}
+		names := []string{}
+		for _, s := range services.Services {
+			names = append(names, *s.ServiceName)
+		}
+		// The metrics are dimensioned by cluster name, which the argument may
+		// not be if it was given as an ARN.
+		clusterName := argClusterName
+		if len(services.Services) > 0 {
+			clusterName = ecsq.ParseARN(aws.StringValue(services.Services[0].ClusterArn)).Name
+		}
+		metrics, err := GetServiceMetrics(ctx, cloudwatch.New(sess), clusterName, names, ServiceUtilizationMetrics, metricsWindow)
+		if err != nil {
+			return WrapError(err, "Could not get metrics")
+		}
+		rows := NewServiceUtilization(metrics)
+		sorter.Sort(rows)
+		if topLimit > 0 && len(rows) > topLimit {
+			rows = rows[:topLimit]
+		}
+		RenderServiceUtilization(os.Stdout, rows)
+		return nil
+	})
+	var (
+		lintService      string
+		lintSeverityFlag = map[string]string{}
+		lintOutputFlag   string
+	)
+	lintCommand := app.Command("lint", "Check the task definitions of the cluster's services for security and reliability problems. Exits non-zero if there are critical problems")
+	RequirePermissions(lintCommand, "ecs:ListServices", "ecs:DescribeServices", "ecs:DescribeTaskDefinition")
+	lintCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	lintCommand.Arg("service", "Only check this service").StringVar(&lintService)
+	lintCommand.Flag("severity", "Override the severity of a rule, as <rule>=critical|warning|info|off. Rules are "+strings.Join(LintRuleNames(), ", ")).
+		StringMapVar(&lintSeverityFlag)
+	lintCommand.Flag("output", "Format to render the findings in. The options are: table, json, sarif. Defaults to table").
+		Short('o').Default("table").EnumVar(&lintOutputFlag, "table", "json", "sarif")
+	lintCommand.Action(func(*kingpin.ParseContext) error {
+		opts, err := ParseLintSeverities(lintSeverityFlag)
+		if err != nil {
+			return InvalidInputError(err, "Invalid --severity")
+		}
+		taskDefinitions, err := GetLintTaskDefinitions(ctx, svc, argClusterName, lintService)
+		if err != nil {
+			return WrapError(err, "Could not describe task definitions")
+		}
+		findings := []Finding{}
+		for _, td := range taskDefinitions {
+			findings = append(findings, LintTaskDefinition(td, opts)...)
+		}
+		if err := RenderLintFindings(os.Stdout, findings, lintOutputFlag); err != nil {
+			return WrapError(err, "Could not render findings")
+		}
+		if HasCritical(findings) {
+			exitCode = ExitFindings
+		}
+		return nil
+	})
+	var capacityOutputFlag string
+	capacityCommand := app.Command("capacity", "Show the registered and remaining CPU, memory and ports of the cluster's container instances, and the resources reserved by each service")
+	RequirePermissions(capacityCommand,
+		"ecs:ListContainerInstances", "ecs:DescribeContainerInstances", "ecs:ListServices", "ecs:DescribeServices", "ecs:DescribeTaskDefinition",
+	)
+	capacityCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	capacityCommand.Flag("output", "Format to render the report in. The options are: table, json. Defaults to table").
+		Short('o').Default("table").EnumVar(&capacityOutputFlag, "table", "json")
+	capacityCommand.Action(func(*kingpin.ParseContext) error {
+		report, err := GetCapacityReport(ctx, svc, argClusterName)
+		if err != nil {
+			return WrapError(err, "Could not describe cluster")
+		}
+		if err := RenderCapacityReport(os.Stdout, report, capacityOutputFlag); err != nil {
+			return WrapError(err, "Could not render report")
+		}
+		return nil
+	})
+	var discoveryOutputFlag string
+	discoveryCommand := app.Command("discovery", "List the Cloud Map and Service Connect names that each service in the cluster can be reached by")
+	RequirePermissions(discoveryCommand,
+		"ecs:ListServices", "ecs:DescribeServices", "servicediscovery:GetService", "servicediscovery:GetNamespace",
+	)
+	discoveryCommand.Arg("cluster", "Name of the cluster").Required().StringVar(&argClusterName)
+	discoveryCommand.Flag("output", "Format to render the names in. The options are: table, json. Defaults to table").
+		Short('o').Default("table").EnumVar(&discoveryOutputFlag, "table", "json")
+	discoveryCommand.Action(func(*kingpin.ParseContext) error {
+		entries, err := GetClusterDiscovery(ctx, svc, NewCloudMap(servicediscovery.New(sess)), argClusterName)
+		if err != nil {
+			return WrapError(err, "Could not describe service discovery")
+		}
+		if err := RenderDiscoveryEntries(os.Stdout, entries, discoveryOutputFlag); err != nil {
+			return WrapError(err, "Could not render names")
+		}
+		return nil
+	})
+	var iamPolicyCommands []string
+	iamPolicyCommand := app.Command("iam-policy", "Print the IAM policy the given commands need, or every command if none are given")
+	RequirePermissions(iamPolicyCommand)
+	iamPolicyCommand.Arg("command", "Commands to include in the policy").StringsVar(&iamPolicyCommands)
+	iamPolicyCommand.Action(func(*kingpin.ParseContext) error {
+		policy, err := NewIAMPolicy(iamPolicyCommands)
+		if err != nil {
+			return InvalidInputError(err, "Invalid command")
+		}
+		if err := WriteIAMPolicy(os.Stdout, policy); err != nil {
+			return WrapError(err, "Could not write policy")
+		}
+		return nil
+	})
+	MustDeclarePermissions(app)
+	_, err := app.Parse(args)
+	jsonErrors = errorFormat == "json"
+	if apiLog != nil {
+		apiLog.RenderSummary(os.Stderr)
+	}
+	if cache != nil {
+		if oldest := cache.OldestEntry(); !oldest.IsZero() {
+			fmt.Fprintln(os.Stderr, FormatCacheAge(oldest))
+		}
 	}
-	if len(pieces) >= 7 {
-		arn.Instance = pieces[6]
+	if err != nil {
+		var commandErr *CommandError
+		if !errors.As(err, &commandErr) {
+			// Anything else comes from kingpin parsing the command line.
+			err = NewError(KindInvalidInput, "%v, try --help", err)
+		}
+		// Scripts asking for JSON get the error as JSON on stdout, in place of the results.
+		out := os.Stderr
+		if jsonErrors {
+			out = os.Stdout
+		}
+		exitCode = ReportError(out, err, jsonErrors)
 	}
-	return arn
+	cancel()
+	return exitCode
 }
 
-const taskIDRawPattern = `(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]{32})`
-
-var (
-	taskIDPattern  = regexp.MustCompile("^" + taskIDRawPattern + "$")
-	taskARNPattern = regexp.MustCompile(`^arn:aws:ecs:[a-z]+-[a-z]+-\d:\d+:task/(([a-zA-Z-])+/)?` + taskIDRawPattern + "$")
-)
-
-func isTaskARN(s string) bool {
-	return taskARNPattern.MatchString(s)
+// newClient returns a library client for the ECS API, expanding service names with
+// ECSQ_SERVICE_NAME_EXPANSION.
+func newClient(svc ecsiface.ECSAPI) *ecsq.Client {
+	client := ecsq.New(svc)
+	client.ServiceNameExpansion = os.Getenv(ecsq.ServiceNameExpansionEnv)
+	return client
 }
 
-func isTaskID(s string) bool {
-	return taskIDPattern.MatchString(s)
+func getTaskDetail(ctx context.Context, svc *ecs.ECS, clusterName, taskID string) (*ecs.Task, error) {
+	return newClient(svc).DescribeTask(ctx, clusterName, taskID)
 }
 
-func getTaskDetail(svc *ecs.ECS, clusterName, taskID string) (*ecs.Task, error) {
-	result, err := svc.DescribeTasks(&ecs.DescribeTasksInput{
-		Cluster: &clusterName,
-		Tasks:   []*string{&taskID},
-	})
-	if err != nil {
-		return nil, err
-	}
-	if len(result.Failures) > 0 {
-		return nil, errors.New(*result.Failures[0].Reason)
-	}
-	return result.Tasks[0], nil
+func getServiceDetail(ctx context.Context, svc *ecs.ECS, clusterName, serviceName string) (*ecs.Service, error) {
+	return newClient(svc).DescribeService(ctx, clusterName, serviceName)
 }
 
-func getServiceDetail(svc *ecs.ECS, clusterName, serviceName string) (*ecs.Service, error) {
-	result, err := svc.DescribeServices(&ecs.DescribeServicesInput{
-		Cluster:  &clusterName,
-		Services: []*string{aws.String(FormatServiceName(clusterName, serviceName))},
-	})
-	if err != nil {
-		return nil, err
-	}
-	if len(result.Failures) > 0 {
-		return nil, errors.New(*result.Failures[0].Reason)
-	}
-	return result.Services[0], nil
+// FormatServiceName parses a potentially short service name and returns the full service name. The
+// error wraps ecsq.ErrInvalidServiceNameExpansion if ECSQ_SERVICE_NAME_EXPANSION is invalid.
+func FormatServiceName(cluster, service string) (string, error) {
+	return ecsq.ExpandServiceName(os.Getenv(ecsq.ServiceNameExpansionEnv), cluster, service)
 }
 
-// ServiceLink returns the URL to the ECS service on the AWS console
-func ServiceLink(region, cluster, service string) string {
-	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/services/%v/tasks"
-	return fmt.Sprintf(tmpl, region, region, cluster, service)
+// ShortServiceName reverses ECSQ_SERVICE_NAME_EXPANSION, returning the short name of a full
+// service name. If no expansion is configured or the name does not match it, the name is returned
+// unchanged.
+func ShortServiceName(cluster, service string) string {
+	return ecsq.ShortServiceName(os.Getenv(ecsq.ServiceNameExpansionEnv), cluster, service)
 }
 
-// TaskLink returns the URL to the ECS task on the AWS console
-func TaskLink(region, cluster, taskID string) string {
-	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/tasks/%v"
-	return fmt.Sprintf(tmpl, region, region, cluster, taskID)
+// listServices describes every service in the cluster. If progress is not nil, it is called with the
+// number of services found so far after each page is described.
+func listServices(ctx context.Context, svc *ecs.ECS, clusterName string, progress func(n int)) (*ecsq.ServiceList, error) {
+	return newClient(svc).ListServices(ctx, clusterName, progress)
 }
 
-// TaskDefinitionLink returns the URL to the ECS task definition on the AWS console.
-func TaskDefinitionLink(region string, taskDefinition *ARN) string {
-	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/taskDefinitions/%v/%v"
-	return fmt.Sprintf(tmpl, region, region, taskDefinition.Name, taskDefinition.Instance)
+// getTasksArns lists the tasks with the given desired status. If serviceName is empty, tasks for the
+// whole cluster are listed.
+func getTasksArns(ctx context.Context, svc *ecs.ECS, clusterName, serviceName, status string) ([]*string, error) {
+	return newClient(svc).ListTaskArns(ctx, clusterName, serviceName, status)
 }
 
-// ContainerInstanceLink returns the URL to the ECS container instance on the AWS console.
-func ContainerInstanceLink(region, cluster, containerInstance string) string {
-	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/containerInstances/%v"
-	return fmt.Sprintf(tmpl, region, region, cluster, containerInstance)
+// describeTasks describes the given tasks, batching requests to stay within the DescribeTasks limit.
+func describeTasks(ctx context.Context, svc *ecs.ECS, clusterName string, taskArns []*string) (*ecsq.TaskList, error) {
+	return newClient(svc).DescribeTasks(ctx, clusterName, taskArns)
 }
 
-// EC2InstanceLink returns the URL to the EC2 instance on the AWS console.
-func EC2InstanceLink(region, ec2Instance string) string {
-	tmpl := "https://%v.console.aws.amazon.com/ec2/v2/home?region=%v#Instances:instanceId=%v"
-	return fmt.Sprintf(tmpl, region, region, ec2Instance)
+// listContainerInstances describes every container instance registered to the cluster.
+func listContainerInstances(ctx context.Context, svc *ecs.ECS, clusterName string) ([]*ecs.ContainerInstance, error) {
+	return newClient(svc).ListContainerInstances(ctx, clusterName)
 }
 
-// FormatServiceName parses a potentially short service name and returns the full service name
-func FormatServiceName(cluster, service string) string {
-	var (
-		serviceNameExpansion = os.Getenv("ECSQ_SERVICE_NAME_EXPANSION")
-		serviceNameTemplate  *template.Template
-	)
-	if serviceNameExpansion != "" {
-		// First detect if service name has already been expanded.
-		interpolateRegex := regexp.MustCompile("{{.*}}")
-		alreadyExpandedRegex, err := regexp.Compile(interpolateRegex.ReplaceAllString(serviceNameExpansion, ".*"))
-		if err == nil && alreadyExpandedRegex.MatchString(service) {
-			return service
+// resourceValue returns the integer value of the named resource, such as CPU or MEMORY.
+func resourceValue(resources []*ecs.Resource, name string) int64 {
+	for _, r := range resources {
+		if aws.StringValue(r.Name) == name {
+			return aws.Int64Value(r.IntegerValue)
 		}
-		serviceNameTemplate, err = template.New("serviceName").Parse(serviceNameExpansion)
-		if err != nil {
-			panic(fmt.Errorf("Invalid ECSQ_SERVICE_NAME_EXPANSION template %v", err))
-		}
-		buffer := bytes.NewBuffer(nil)
-		err = serviceNameTemplate.Execute(buffer, struct {
-			Name    string
-			Cluster string
-		}{
-			Name:    service,
-			Cluster: cluster,
-		})
-		if err != nil {
-			panic(fmt.Errorf("Invalid ECSQ_SERVICE_NAME_EXPANSION template %v", err))
-		}
-		return buffer.String()
 	}
-	return service
+	return 0
 }
 
-func getTasksArns(svc *ecs.ECS, clusterName, serviceName, status string) ([]*string, error) {
-	tasks := []*string{}
-	err := svc.ListTasksPages(&ecs.ListTasksInput{
-		Cluster:       &clusterName,
-		ServiceName:   &serviceName,
-		DesiredStatus: aws.String(status),
-	}, func(page *ecs.ListTasksOutput, lastPage bool) bool {
-		tasks = append(tasks, page.TaskArns...)
-		return true
-	})
-	return tasks, err
+// getTaskDefinitions describes each distinct task definition once and returns them keyed by ARN.
+func getTaskDefinitions(ctx context.Context, svc *ecs.ECS, taskDefinitionArns []string) (map[string]*ecs.TaskDefinition, error) {
+	return newClient(svc).DescribeTaskDefinitions(ctx, taskDefinitionArns)
 }
 
 // PrintFailures prints failures from bulk commands
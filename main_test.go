@@ -1,21 +1,10 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
-func TestIsTestID(t *testing.T) {
-	assertTrue(t, isTaskARN("arn:aws:ecs:us-east-1:1111111111:task/dev-cluster/0b4b2b4daf475ee0bf19157238902649"))
-	assertTrue(t, isTaskARN("arn:aws:ecs:us-east-1:1111111111:task/Staging/0b4b2b4daf475ee0bf19157238902649"))
-	assertTrue(t, isTaskARN("arn:aws:ecs:us-west-2:4817267453:task/bfbf861b-7f10-4dfb-b344-32169dc3e55c"))
-
-	assertFalse(t, isTaskARN("bad-prefix/0b4b2b4daf475ee0bf19157238902649"))
-	assertFalse(t, isTaskARN("arn:aws:ecs:us-east-1:1111111111:task/1234/0b4b2b4daf475ee0bf19157238902649"))
-
-	assertTrue(t, isTaskID("0b4b2b4daf475ee0bf19157238902649"))
-	assertTrue(t, isTaskID("bfbf861b-7f10-4dfb-b344-32169dc3e55c"))
-}
-
 func assertTrue(t *testing.T, v bool) {
 	t.Helper()
 	if !v {
@@ -29,3 +18,43 @@ func assertFalse(t *testing.T, v bool) {
 		t.Errorf("Expected true, but was false")
 	}
 }
+
+func TestTaskFargate(t *testing.T) {
+	f, server := startFakeAWS(t, t.TempDir())
+	task := func() (int, string) {
+		var code int
+		stdout, _ := captureOutput(t, func() {
+			code = run([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache", "task", "ecs-prod", "0123456789abcdef0123456789abcdef"})
+		})
+		return code, stdout
+	}
+	original := fakeAWSResponses["ecs:DescribeTasks"]
+	t.Cleanup(func() { fakeAWSResponses["ecs:DescribeTasks"] = original })
+
+	// A Fargate task has no container instance or EC2 instance to describe.
+	fakeAWSResponses["ecs:DescribeTasks"] = `{"tasks":[{
+		"taskArn":"arn:aws:ecs:us-west-2:111111111111:task/ecs-prod/0123456789abcdef0123456789abcdef",
+		"taskDefinitionArn":"arn:aws:ecs:us-west-2:111111111111:task-definition/web:3",
+		"lastStatus":"RUNNING","launchType":"FARGATE",
+		"containers":[{"name":"web","lastStatus":"RUNNING","networkBindings":[{"containerPort":80}]}]
+	}]}`
+	code, stdout := task()
+	assertTrue(t, code == 0)
+	assertTrue(t, strings.Contains(stdout, "0123456789abcdef0123456789abcdef"))
+	assertFalse(t, strings.Contains(stdout, "EC2 Instance"))
+	assertFalse(t, f.actions["ecs:DescribeContainerInstances"])
+	assertFalse(t, f.actions["ec2:DescribeInstances"])
+}
+
+func TestTaskMissingContainerInstance(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	original := fakeAWSResponses["ecs:DescribeContainerInstances"]
+	fakeAWSResponses["ecs:DescribeContainerInstances"] = `{"containerInstances":[]}`
+	t.Cleanup(func() { fakeAWSResponses["ecs:DescribeContainerInstances"] = original })
+
+	var code int
+	captureOutput(t, func() {
+		code = run([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache", "task", "ecs-prod", "0123456789abcdef0123456789abcdef"})
+	})
+	assertTrue(t, code == KindNotFound.ExitCode())
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ErrNoMetadataEndpoint is returned when ecsq is not running inside an ECS task.
+var ErrNoMetadataEndpoint = errors.New("ECS_CONTAINER_METADATA_URI_V4 is not set, ecsq is not running inside an ECS task")
+
+// TaskMetadata is the task metadata returned by version 4 of the ECS task metadata endpoint.
+type TaskMetadata struct {
+	Cluster          string
+	TaskARN          string
+	Family           string
+	Revision         string
+	DesiredStatus    string
+	KnownStatus      string
+	AvailabilityZone string
+	LaunchType       string
+	Limits           MetadataLimits
+	Containers       []ContainerMetadata
+}
+
+// MetadataLimits are the CPU (in vCPUs) and memory (in MiB) limits of a task or container.
+type MetadataLimits struct {
+	CPU    float64
+	Memory int64
+}
+
+// ContainerMetadata is the metadata of a container in the task.
+type ContainerMetadata struct {
+	DockerID    string `json:"DockerId"`
+	Name        string
+	Image       string
+	KnownStatus string
+	ExitCode    *int64
+	Limits      MetadataLimits
+	Networks    []ContainerNetwork
+	Ports       []ContainerPortMetadata
+}
+
+// ContainerNetwork is a network a container is attached to.
+type ContainerNetwork struct {
+	NetworkMode   string
+	IPv4Addresses []string
+}
+
+// ContainerPortMetadata is a port a container exposes.
+type ContainerPortMetadata struct {
+	ContainerPort int64
+	Protocol      string
+	HostPort      int64
+	HostIP        string `json:"HostIp"`
+}
+
+// ContainerStats is the subset of the Docker stats of a container that ecsq shows.
+type ContainerStats struct {
+	Read        time.Time `json:"read"`
+	CPUStats    CPUStats  `json:"cpu_stats"`
+	PreCPUStats CPUStats  `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage int64 `json:"usage"`
+		Limit int64 `json:"limit"`
+	} `json:"memory_stats"`
+}
+
+// CPUStats are cumulative CPU usage counters, in nanoseconds.
+type CPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemCPUUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs     int    `json:"online_cpus"`
+}
+
+// CPUPercent returns the CPU usage between the previous and current sample, as a percentage of
+// one CPU, the way docker stats does.
+func (s *ContainerStats) CPUPercent() float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := s.CPUStats.OnlineCPUs
+	if cpus == 0 {
+		cpus = 1
+	}
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// MetadataClient reads the ECS task metadata endpoint.
+type MetadataClient struct {
+	URI        string
+	HTTPClient *http.Client
+}
+
+// NewMetadataClientFromEnv returns a client for the endpoint in ECS_CONTAINER_METADATA_URI_V4.
+func NewMetadataClientFromEnv() (*MetadataClient, error) {
+	uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if uri == "" {
+		return nil, ErrNoMetadataEndpoint
+	}
+	return &MetadataClient{URI: uri, HTTPClient: &http.Client{Timeout: 5 * time.Second}}, nil
+}
+
+// Task returns the metadata of the task ecsq is running in.
+func (c *MetadataClient) Task(ctx context.Context) (*TaskMetadata, error) {
+	task := &TaskMetadata{}
+	return task, c.get(ctx, "/task", task)
+}
+
+// Stats returns the Docker stats of the task's containers, keyed by Docker ID. Containers that are
+// not running have nil stats.
+func (c *MetadataClient) Stats(ctx context.Context) (map[string]*ContainerStats, error) {
+	stats := map[string]*ContainerStats{}
+	return stats, c.get(ctx, "/task/stats", &stats)
+}
+
+func (c *MetadataClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.URI, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v: %v", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// TaskLinks are console links for a task, filled in from the AWS APIs when they are reachable.
+type TaskLinks struct {
+	Task                string
+	TaskDefinition      string
+	ContainerInstance   string
+	ContainerInstanceID string
+}
+
+// TaskRegion returns the region of the task, from its ARN.
+func (t *TaskMetadata) TaskRegion() string {
+	pieces := strings.Split(t.TaskARN, ":")
+	if len(pieces) < 4 {
+		return ""
+	}
+	return pieces[3]
+}
+
+// ClusterName returns the name of the task's cluster, which the endpoint may report as an ARN.
+func (t *TaskMetadata) ClusterName() string {
+	if strings.HasPrefix(t.Cluster, "arn:") {
+		return ecsq.ParseARN(t.Cluster).Name
+	}
+	return t.Cluster
+}
+
+// GetTaskLinks builds console links for the task. The container instance is looked up with the
+// ECS API. If the API cannot be reached, the links that need it are left out and the error is
+// returned alongside.
+func GetTaskLinks(ctx context.Context, svc *ecs.ECS, task *TaskMetadata) (TaskLinks, error) {
+	region, cluster := task.TaskRegion(), task.ClusterName()
+	taskID := ecsq.TaskID(task.TaskARN)
+	links := TaskLinks{
+		Task:           ecsq.TaskLink(region, cluster, taskID),
+		TaskDefinition: ecsq.TaskDefinitionLink(region, &ecsq.ARN{Name: task.Family, Instance: task.Revision}),
+	}
+	if task.LaunchType == ecs.LaunchTypeFargate {
+		return links, nil
+	}
+	detail, err := getTaskDetail(ctx, svc, cluster, task.TaskARN)
+	if err != nil {
+		return links, err
+	}
+	if detail.ContainerInstanceArn != nil {
+		links.ContainerInstanceID = ecsq.ParseARN(*detail.ContainerInstanceArn).Name
+		links.ContainerInstance = ecsq.ContainerInstanceLink(region, cluster, links.ContainerInstanceID)
+	}
+	return links, nil
+}
+
+// RenderTaskMetadata writes the task metadata, container limits, networks and stats in the same
+// layout as the task command.
+func RenderTaskMetadata(w io.Writer, task *TaskMetadata, stats map[string]*ContainerStats, links TaskLinks) {
+	taskID := ecsq.TaskID(task.TaskARN)
+	rows := [][]string{
+		{"Task ID", taskID},
+		{"Task ARN", task.TaskARN},
+		{"Cluster", task.Cluster},
+		{"Task Definition", task.Family + ":" + task.Revision},
+		{"Status", task.KnownStatus},
+		{"Launch Type", task.LaunchType},
+		{"Availability Zone", task.AvailabilityZone},
+		{"CPU Limit", formatVCPU(task.Limits.CPU)},
+		{"Memory Limit", formatMemoryLimit(task.Limits.Memory)},
+	}
+	if links.ContainerInstanceID != "" {
+		rows = append(rows, []string{"Container Instance", links.ContainerInstanceID})
+	}
+	for _, link := range [][]string{
+		{"Task Link", links.Task},
+		{"Task Definition Link", links.TaskDefinition},
+		{"Container Instance Link", links.ContainerInstance},
+	} {
+		if link[1] != "" {
+			rows = append(rows, link)
+		}
+	}
+	table := NewTable(w)
+	table.AppendBulk(FitRows(nil, rows, TerminalWidth()))
+	fmt.Fprintln(w, "Details:")
+	table.Render()
+
+	fmt.Fprintln(w, "Containers:")
+	table = tablewriter.NewWriter(w)
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, c := range task.Containers {
+		table.Append([]string{c.Name, "Status", c.KnownStatus})
+		table.Append([]string{c.Name, "Image", c.Image})
+		if c.ExitCode != nil {
+			table.Append([]string{c.Name, "Exit Code", strconv.FormatInt(*c.ExitCode, 10)})
+		}
+		if c.Limits.CPU > 0 {
+			table.Append([]string{c.Name, "CPU Limit", strconv.FormatFloat(c.Limits.CPU, 'f', -1, 64) + " units"})
+		}
+		if c.Limits.Memory > 0 {
+			table.Append([]string{c.Name, "Memory Limit", formatMemoryLimit(c.Limits.Memory)})
+		}
+		for _, n := range c.Networks {
+			table.Append([]string{c.Name, "Network - " + n.NetworkMode, strings.Join(n.IPv4Addresses, ", ")})
+		}
+		for _, p := range c.Ports {
+			port := strconv.FormatInt(p.ContainerPort, 10) + "/" + p.Protocol
+			if p.HostPort != 0 {
+				port += " -> " + p.HostIP + ":" + strconv.FormatInt(p.HostPort, 10)
+			}
+			table.Append([]string{c.Name, "Network - Port", port})
+		}
+		if s := stats[c.DockerID]; s != nil {
+			table.Append([]string{c.Name, "CPU Usage", strconv.FormatFloat(s.CPUPercent(), 'f', 1, 64) + "%"})
+			table.Append([]string{c.Name, "Memory Usage", fmt.Sprintf("%v of %v", formatBytes(s.MemoryStats.Usage), formatBytes(s.MemoryStats.Limit))})
+		}
+	}
+	table.Render()
+}
+
+func formatVCPU(cpu float64) string {
+	if cpu == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(cpu, 'f', -1, 64) + " vCPU"
+}
+
+func formatMemoryLimit(mib int64) string {
+	if mib == 0 {
+		return ""
+	}
+	return strconv.FormatInt(mib, 10) + " MiB"
+}
+
+func formatBytes(b int64) string {
+	const mib = 1 << 20
+	return strconv.FormatFloat(float64(b)/mib, 'f', 1, 64) + " MiB"
+}
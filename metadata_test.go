@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const taskMetadataJSON = `{
+  "Cluster": "arn:aws:ecs:us-west-2:123456789012:cluster/ecs-prod",
+  "TaskARN": "arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7",
+  "Family": "task-applepicker-ecs-prod",
+  "Revision": "38",
+  "KnownStatus": "RUNNING",
+  "LaunchType": "FARGATE",
+  "AvailabilityZone": "us-west-2a",
+  "Limits": {"CPU": 0.5, "Memory": 1024},
+  "Containers": [{
+    "DockerId": "abc123",
+    "Name": "applepicker",
+    "Image": "applepicker:1.2.3",
+    "KnownStatus": "RUNNING",
+    "Limits": {"CPU": 256, "Memory": 512},
+    "Networks": [{"NetworkMode": "awsvpc", "IPv4Addresses": ["10.0.12.34"]}],
+    "Ports": [{"ContainerPort": 8000, "Protocol": "tcp"}]
+  }]
+}`
+
+const taskStatsJSON = `{
+  "abc123": {
+    "cpu_stats": {"cpu_usage": {"total_usage": 300000000}, "system_cpu_usage": 2000000000, "online_cpus": 2},
+    "precpu_stats": {"cpu_usage": {"total_usage": 200000000}, "system_cpu_usage": 1000000000, "online_cpus": 2},
+    "memory_stats": {"usage": 104857600, "limit": 536870912}
+  },
+  "stopped": null
+}`
+
+func TestMetadataClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4/abc123/task":
+			w.Write([]byte(taskMetadataJSON))
+		case "/v4/abc123/task/stats":
+			w.Write([]byte(taskStatsJSON))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", server.URL+"/v4/abc123")
+
+	client, err := NewMetadataClientFromEnv()
+	assertTrue(t, err == nil)
+	task, err := client.Task(context.Background())
+	assertTrue(t, err == nil)
+	assertTrue(t, task.ClusterName() == "ecs-prod")
+	assertTrue(t, task.TaskRegion() == "us-west-2")
+	assertTrue(t, task.Limits.CPU == 0.5 && task.Limits.Memory == 1024)
+	assertTrue(t, len(task.Containers) == 1 && task.Containers[0].DockerID == "abc123")
+	assertTrue(t, task.Containers[0].Networks[0].IPv4Addresses[0] == "10.0.12.34")
+
+	stats, err := client.Stats(context.Background())
+	assertTrue(t, err == nil)
+	assertTrue(t, stats["stopped"] == nil)
+	assertTrue(t, stats["abc123"].CPUPercent() == 20)
+
+	links, err := GetTaskLinks(context.Background(), nil, task)
+	assertTrue(t, err == nil && links.ContainerInstance == "")
+	assertTrue(t, strings.HasSuffix(links.Task, "#/clusters/ecs-prod/tasks/6f0e3f2ab1c84e2fa8d1a6d2c1b0e9f7"))
+
+	var out bytes.Buffer
+	RenderTaskMetadata(&out, task, stats, links)
+	assertTrue(t, strings.Contains(out.String(), "20.0%"))
+	assertTrue(t, strings.Contains(out.String(), "100.0 MiB of 512.0 MiB"))
+
+	client.URI = server.URL + "/v4/missing"
+	_, err = client.Task(context.Background())
+	assertTrue(t, err != nil)
+}
+
+func TestNoMetadataEndpoint(t *testing.T) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+	_, err := NewMetadataClientFromEnv()
+	assertTrue(t, err == ErrNoMetadataEndpoint)
+}
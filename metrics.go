@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ServiceMetric is a CloudWatch metric with ClusterName and ServiceName dimensions.
+type ServiceMetric struct {
+	Label     string
+	Namespace string
+	Name      string
+	Stat      string
+	Unit      string
+}
+
+// ServiceUtilizationMetrics are the CPU and memory utilization metrics ECS publishes for every
+// service.
+var ServiceUtilizationMetrics = []ServiceMetric{
+	{Label: "CPU", Namespace: "AWS/ECS", Name: "CPUUtilization", Stat: "Average", Unit: "%"},
+	{Label: "Memory", Namespace: "AWS/ECS", Name: "MemoryUtilization", Stat: "Average", Unit: "%"},
+}
+
+// ContainerInsightsMetrics are the task-level metrics published when Container Insights is enabled
+// on the cluster.
+var ContainerInsightsMetrics = []ServiceMetric{
+	{Label: "CPU Utilized", Namespace: "ECS/ContainerInsights", Name: "CpuUtilized", Stat: "Average", Unit: " units"},
+	{Label: "Memory Utilized", Namespace: "ECS/ContainerInsights", Name: "MemoryUtilized", Stat: "Average", Unit: " MiB"},
+	{Label: "Running Tasks", Namespace: "ECS/ContainerInsights", Name: "RunningTaskCount", Stat: "Average"},
+	{Label: "Network Rx", Namespace: "ECS/ContainerInsights", Name: "NetworkRxBytes", Stat: "Average", Unit: " B/s"},
+	{Label: "Network Tx", Namespace: "ECS/ContainerInsights", Name: "NetworkTxBytes", Stat: "Average", Unit: " B/s"},
+}
+
+// MetricSeries is a metric's values over time, oldest first.
+type MetricSeries struct {
+	Metric ServiceMetric
+	Values []float64
+}
+
+// Current returns the most recent value, or 0 if there are none.
+func (s MetricSeries) Current() float64 {
+	if len(s.Values) == 0 {
+		return 0
+	}
+	return s.Values[len(s.Values)-1]
+}
+
+// Average returns the mean of the values, or 0 if there are none.
+func (s MetricSeries) Average() float64 {
+	if len(s.Values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range s.Values {
+		sum += v
+	}
+	return sum / float64(len(s.Values))
+}
+
+// Max returns the largest value, or 0 if there are none.
+func (s MetricSeries) Max() float64 {
+	max := 0.0
+	for i, v := range s.Values {
+		if i == 0 || v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Format renders a value of the series with its unit.
+func (s MetricSeries) Format(v float64) string {
+	if len(s.Values) == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + s.Metric.Unit
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders the values as a line of unicode bars, scaled between the smallest and largest
+// value.
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(sparks)-1))
+		}
+		line[i] = sparks[level]
+	}
+	return string(line)
+}
+
+// MetricPeriod picks a period for a window, in whole minutes, so that the window has at most
+// points values.
+func MetricPeriod(window time.Duration, points int) time.Duration {
+	period := (window/time.Duration(points) + time.Minute - 1).Truncate(time.Minute)
+	if period < time.Minute {
+		period = time.Minute
+	}
+	return period
+}
+
+// sparklinePoints is how many values are fetched for a window, which is the width of a sparkline.
+const sparklinePoints = 30
+
+// maxMetricDataQueries is the most queries a single GetMetricData request can make.
+const maxMetricDataQueries = 500
+
+// GetServiceMetrics fetches the metrics of each service over the window ending now. The result is
+// keyed by service name, and holds a series per metric, in the order of the metrics.
+func GetServiceMetrics(ctx context.Context, cw *cloudwatch.CloudWatch, clusterName string, serviceNames []string, metrics []ServiceMetric, window time.Duration) (map[string][]MetricSeries, error) {
+	end := time.Now().Truncate(time.Minute)
+	start := end.Add(-window)
+	period := int64(MetricPeriod(window, sparklinePoints).Seconds())
+	queries := []*cloudwatch.MetricDataQuery{}
+	result := map[string][]MetricSeries{}
+	type queryKey struct {
+		service string
+		metric  int
+	}
+	keys := map[string]queryKey{}
+	for s, service := range serviceNames {
+		result[service] = make([]MetricSeries, len(metrics))
+		for m, metric := range metrics {
+			result[service][m].Metric = metric
+			id := fmt.Sprintf("m%d_%d", s, m)
+			keys[id] = queryKey{service, m}
+			queries = append(queries, &cloudwatch.MetricDataQuery{
+				Id: aws.String(id),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String(metric.Namespace),
+						MetricName: aws.String(metric.Name),
+						Dimensions: []*cloudwatch.Dimension{
+							{Name: aws.String("ClusterName"), Value: aws.String(clusterName)},
+							{Name: aws.String("ServiceName"), Value: aws.String(service)},
+						},
+					},
+					Period: aws.Int64(period),
+					Stat:   aws.String(metric.Stat),
+				},
+			})
+		}
+	}
+	for begin := 0; begin < len(queries); begin += maxMetricDataQueries {
+		finish := begin + maxMetricDataQueries
+		if finish > len(queries) {
+			finish = len(queries)
+		}
+		err := cw.GetMetricDataPagesWithContext(ctx, &cloudwatch.GetMetricDataInput{
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(end),
+			ScanBy:            aws.String(cloudwatch.ScanByTimestampAscending),
+			MetricDataQueries: queries[begin:finish],
+		}, func(page *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+			for _, r := range page.MetricDataResults {
+				key, ok := keys[aws.StringValue(r.Id)]
+				if !ok {
+					continue
+				}
+				series := &result[key.service][key.metric]
+				series.Values = append(series.Values, aws.Float64ValueSlice(r.Values)...)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RenderMetricSeries writes the series that have values as a table, one metric per row.
+func RenderMetricSeries(w io.Writer, series []MetricSeries) {
+	table := NewTable(w)
+	table.SetHeader([]string{"Metric", "Current", "Average", "Max", "Trend"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, s := range series {
+		if len(s.Values) == 0 {
+			continue
+		}
+		table.Append([]string{s.Metric.Label, s.Format(s.Current()), s.Format(s.Average()), s.Format(s.Max()), Sparkline(s.Values)})
+	}
+	table.Render()
+}
+
+// ServiceUtilization is the CPU and memory utilization of a service, for the top command.
+type ServiceUtilization struct {
+	Service string
+	CPU     MetricSeries
+	Memory  MetricSeries
+}
+
+// NewServiceUtilization pairs up the series fetched for ServiceUtilizationMetrics.
+func NewServiceUtilization(metrics map[string][]MetricSeries) []*ServiceUtilization {
+	rows := []*ServiceUtilization{}
+	for service, series := range metrics {
+		rows = append(rows, &ServiceUtilization{Service: service, CPU: series[0], Memory: series[1]})
+	}
+	MustParseSort("name", ServiceUtilizationSortKeys).Sort(rows)
+	return rows
+}
+
+// ServiceUtilizationSortKeys are the keys the top command can sort by.
+var ServiceUtilizationSortKeys = []SortKey[*ServiceUtilization]{
+	StringKey("name", func(u *ServiceUtilization) string { return u.Service }),
+	FloatKey("cpu", func(u *ServiceUtilization) float64 { return u.CPU.Current() }),
+	FloatKey("cpu-avg", func(u *ServiceUtilization) float64 { return u.CPU.Average() }),
+	FloatKey("cpu-max", func(u *ServiceUtilization) float64 { return u.CPU.Max() }),
+	FloatKey("memory", func(u *ServiceUtilization) float64 { return u.Memory.Current() }),
+	FloatKey("memory-avg", func(u *ServiceUtilization) float64 { return u.Memory.Average() }),
+	FloatKey("memory-max", func(u *ServiceUtilization) float64 { return u.Memory.Max() }),
+}
+
+// RenderServiceUtilization writes a row per service with its current, average and max CPU and
+// memory utilization, and their trends.
+func RenderServiceUtilization(w io.Writer, rows []*ServiceUtilization) {
+	header := []string{}
+	for _, metric := range []string{"CPU", "Memory"} {
+		header = append(header, metric, metric+" Avg", metric+" Max", metric+" Trend")
+	}
+	header = append([]string{"Service"}, header...)
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	cells := [][]string{}
+	for _, row := range rows {
+		line := []string{row.Service}
+		for _, s := range []MetricSeries{row.CPU, row.Memory} {
+			line = append(line, s.Format(s.Current()), s.Format(s.Average()), s.Format(s.Max()), Sparkline(s.Values))
+		}
+		cells = append(cells, line)
+	}
+	table.AppendBulk(FitRows(header, cells, TerminalWidth()))
+	table.Render()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	assertTrue(t, Sparkline(nil) == "")
+	assertTrue(t, Sparkline([]float64{0, 7, 14}) == "▁▄█")
+	assertTrue(t, Sparkline([]float64{5, 5}) == "▁▁")
+}
+
+func TestMetricPeriod(t *testing.T) {
+	assertTrue(t, MetricPeriod(time.Hour, 30) == 2*time.Minute)
+	assertTrue(t, MetricPeriod(10*time.Minute, 30) == time.Minute)
+	assertTrue(t, MetricPeriod(25*time.Hour, 30) == 50*time.Minute)
+}
+
+func TestMetricSeries(t *testing.T) {
+	s := MetricSeries{Metric: ServiceUtilizationMetrics[0], Values: []float64{10, 40, 25}}
+	assertTrue(t, s.Current() == 25)
+	assertTrue(t, s.Average() == 25)
+	assertTrue(t, s.Max() == 40)
+	assertTrue(t, s.Format(s.Max()) == "40.0%")
+	assertTrue(t, MetricSeries{}.Format(0) == "-")
+}
+
+func TestServiceUtilizationSort(t *testing.T) {
+	rows := NewServiceUtilization(map[string][]MetricSeries{
+		"idle": {{Values: []float64{1}}, {Values: []float64{90}}},
+		"busy": {{Values: []float64{95}}, {Values: []float64{10}}},
+		"new":  {{}, {}},
+	})
+	assertTrue(t, rows[0].Service == "busy" && rows[1].Service == "idle" && rows[2].Service == "new")
+	MustParseSort("-memory", ServiceUtilizationSortKeys).Sort(rows)
+	assertTrue(t, rows[0].Service == "idle" && rows[1].Service == "busy")
+}
+
+func TestMetricsWindowFlag(t *testing.T) {
+	_, server := startFakeAWS(t, t.TempDir())
+	for _, args := range [][]string{
+		{"service", "ecs-prod", "applepicker", "--metrics", "--window=0s"},
+		{"top", "ecs-prod", "--window=-1h"},
+	} {
+		var code int
+		_, stderr := captureOutput(t, func() {
+			code = run(append([]string{"--region", "us-west-2", "--endpoint-url", server.URL, "--no-cache"}, args...))
+		})
+		assertTrue(t, code == 2)
+		assertTrue(t, strings.Contains(stderr, "Invalid --window"))
+	}
+}
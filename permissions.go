@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+)
+
+// Permissions maps each command to the IAM actions it calls, as declared with RequirePermissions.
+var Permissions = map[string][]string{}
+
+// RequirePermissions declares the IAM actions a command calls, which iam-policy prints a policy
+// for. Commands that do not call AWS declare none. A test runs every command against a fake AWS and
+// checks that it only calls the actions it declares.
+func RequirePermissions(cmd *kingpin.CmdClause, actions ...string) {
+	Permissions[cmd.FullCommand()] = actions
+}
+
+// MustDeclarePermissions panics if a command of the app has not declared its permissions.
+func MustDeclarePermissions(app *kingpin.Application) {
+	for _, cmd := range app.Model().Commands {
+		if _, ok := Permissions[cmd.FullCommand]; !ok {
+			panic(fmt.Sprintf("command %v does not declare its IAM permissions", cmd.FullCommand))
+		}
+	}
+}
+
+// IAMPolicy is an IAM policy document.
+type IAMPolicy struct {
+	Version   string               `json:"Version"`
+	Statement []IAMPolicyStatement `json:"Statement"`
+}
+
+// IAMPolicyStatement is a statement of an IAM policy.
+type IAMPolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource string   `json:"Resource"`
+}
+
+// NewIAMPolicy returns the policy that allows the given commands, or every command if none are
+// given. The actions are only ever read-only Describe and List calls, and ecs:ExecuteCommand for
+// exec, so they are allowed on all resources.
+func NewIAMPolicy(commands []string) (*IAMPolicy, error) {
+	if len(commands) == 0 {
+		for command := range Permissions {
+			commands = append(commands, command)
+		}
+	}
+	set := map[string]bool{}
+	for _, command := range commands {
+		actions, ok := Permissions[command]
+		if !ok {
+			return nil, fmt.Errorf("unknown command %q, the options are %v", command, strings.Join(PermissionCommandNames(), ", "))
+		}
+		for _, action := range actions {
+			set[action] = true
+		}
+	}
+	actions := []string{}
+	for action := range set {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	policy := &IAMPolicy{Version: "2012-10-17", Statement: []IAMPolicyStatement{}}
+	if len(actions) > 0 {
+		policy.Statement = append(policy.Statement, IAMPolicyStatement{
+			Sid:      "Ecsq",
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: "*",
+		})
+	}
+	return policy, nil
+}
+
+// PermissionCommandNames returns the commands that have declared their permissions, sorted.
+func PermissionCommandNames() []string {
+	names := []string{}
+	for command := range Permissions {
+		names = append(names, command)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteIAMPolicy writes the policy as indented JSON.
+func WriteIAMPolicy(w io.Writer, policy *IAMPolicy) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(policy)
+}
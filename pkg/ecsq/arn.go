@@ -0,0 +1,60 @@
+package ecsq
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ARN contains the pieces of an AWS ARN
+type ARN struct {
+	Region   string
+	Type     string
+	Name     string
+	Instance string
+}
+
+// ParseARN breaks a raw AWS ARN string into its pieces and returns an instance of the ARN struct.
+// Strings that are not ARNs return an empty ARN.
+func ParseARN(s string) *ARN {
+	arn := &ARN{}
+	pieces := strings.Split(s, ":")
+	if len(pieces) < 6 {
+		return arn
+	}
+	arn.Region = pieces[3]
+	typeName := strings.SplitN(pieces[5], "/", 2)
+	arn.Type = typeName[0]
+	if len(typeName) >= 2 {
+		arn.Name = typeName[1]
+	}
+	if len(pieces) >= 7 {
+		arn.Instance = pieces[6]
+	}
+	return arn
+}
+
+// TaskID returns the ID of a task from its ARN, which may or may not include the cluster name.
+func TaskID(taskArn string) string {
+	id := ParseARN(taskArn).Name
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	return id
+}
+
+const taskIDRawPattern = `(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]{32})`
+
+var (
+	taskIDPattern  = regexp.MustCompile("^" + taskIDRawPattern + "$")
+	taskARNPattern = regexp.MustCompile(`^arn:aws:ecs:[a-z]+-[a-z]+-\d:\d+:task/(([a-zA-Z-])+/)?` + taskIDRawPattern + "$")
+)
+
+// IsTaskARN returns whether s is a task ARN, in either the old or the long ARN format.
+func IsTaskARN(s string) bool {
+	return taskARNPattern.MatchString(s)
+}
+
+// IsTaskID returns whether s is a task ID.
+func IsTaskID(s string) bool {
+	return taskIDPattern.MatchString(s)
+}
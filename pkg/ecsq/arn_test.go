@@ -0,0 +1,40 @@
+package ecsq
+
+import "testing"
+
+func TestIsTaskID(t *testing.T) {
+	for s, want := range map[string]bool{
+		"arn:aws:ecs:us-east-1:1111111111:task/dev-cluster/0b4b2b4daf475ee0bf19157238902649": true,
+		"arn:aws:ecs:us-east-1:1111111111:task/Staging/0b4b2b4daf475ee0bf19157238902649":     true,
+		"arn:aws:ecs:us-west-2:4817267453:task/bfbf861b-7f10-4dfb-b344-32169dc3e55c":         true,
+		"bad-prefix/0b4b2b4daf475ee0bf19157238902649":                                        false,
+		"arn:aws:ecs:us-east-1:1111111111:task/1234/0b4b2b4daf475ee0bf19157238902649":        false,
+	} {
+		if got := IsTaskARN(s); got != want {
+			t.Errorf("IsTaskARN(%q) = %v, want %v", s, got, want)
+		}
+	}
+	for _, s := range []string{"0b4b2b4daf475ee0bf19157238902649", "bfbf861b-7f10-4dfb-b344-32169dc3e55c"} {
+		if !IsTaskID(s) {
+			t.Errorf("IsTaskID(%q) = false, want true", s)
+		}
+	}
+}
+
+func TestParseARN(t *testing.T) {
+	arn := ParseARN("arn:aws:ecs:us-west-2:123456789012:task-definition/applepicker:38")
+	if arn.Region != "us-west-2" || arn.Type != "task-definition" || arn.Name != "applepicker" || arn.Instance != "38" {
+		t.Errorf("unexpected ARN %+v", arn)
+	}
+	if arn := ParseARN("applepicker"); *arn != (ARN{}) {
+		t.Errorf("expected an empty ARN for a plain name, got %+v", arn)
+	}
+	for _, s := range []string{
+		"arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/0b4b2b4daf475ee0bf19157238902649",
+		"arn:aws:ecs:us-west-2:123456789012:task/0b4b2b4daf475ee0bf19157238902649",
+	} {
+		if got := TaskID(s); got != "0b4b2b4daf475ee0bf19157238902649" {
+			t.Errorf("TaskID(%q) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Package ecsq queries ECS clusters, services and tasks. It is the library behind the ecsq CLI,
+// for Go programs that want to run the same queries.
+//
+//	client := ecsq.New(ecs.New(sess))
+//	task, err := client.ResolveTask(ctx, "ecs-prod", "applepicker")
+//
+// Every method takes a context, which cancels the underlying AWS API calls.
+package ecsq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+)
+
+// Client runs queries against the ECS API.
+type Client struct {
+	ECS ecsiface.ECSAPI
+	// ServiceNameExpansion, if set, expands short service names passed to the client's methods.
+	// See ExpandServiceName.
+	ServiceNameExpansion string
+}
+
+// New returns a client that calls the given ECS API.
+func New(api ecsiface.ECSAPI) *Client {
+	return &Client{ECS: api}
+}
+
+// ServiceList is the result of describing services. Failures lists the services ECS could not
+// describe.
+type ServiceList struct {
+	Services []*ecs.Service
+	Failures []*ecs.Failure
+}
+
+// TaskList is the result of describing tasks. Failures lists the tasks ECS could not describe.
+type TaskList struct {
+	Tasks    []*ecs.Task
+	Failures []*ecs.Failure
+}
+
+// ServiceName expands a possibly short service name with the client's ServiceNameExpansion.
+func (c *Client) ServiceName(cluster, service string) (string, error) {
+	return ExpandServiceName(c.ServiceNameExpansion, cluster, service)
+}
+
+// DescribeTask describes a single task, by ID or ARN. If the task does not exist, the error wraps
+// ErrNotFound.
+func (c *Client) DescribeTask(ctx context.Context, cluster, task string) (*ecs.Task, error) {
+	result, err := c.ECS.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+		Cluster: &cluster,
+		Tasks:   []*string{&task},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Failures) > 0 {
+		return nil, NewFailureError(result.Failures[0])
+	}
+	if len(result.Tasks) == 0 {
+		// ECS should report a failure for a task it doesn't return, but don't rely on it.
+		return nil, &FailureError{Arn: task, Reason: "MISSING"}
+	}
+	return result.Tasks[0], nil
+}
+
+// DescribeService describes a single service, by name or ARN. Short names are expanded. If the
+// service does not exist, the error wraps ErrNotFound.
+func (c *Client) DescribeService(ctx context.Context, cluster, service string) (*ecs.Service, error) {
+	name, err := c.ServiceName(cluster, service)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.ECS.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+		Cluster:  &cluster,
+		Services: []*string{&name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Failures) > 0 {
+		return nil, NewFailureError(result.Failures[0])
+	}
+	if len(result.Services) == 0 {
+		return nil, &FailureError{Arn: name, Reason: "MISSING"}
+	}
+	return result.Services[0], nil
+}
+
+// ListServices describes every service in the cluster, with their tags. If progress is not nil, it
+// is called with the number of services found so far after each page is described. On error,
+// including the context being cancelled, the services described so far are returned with it.
+func (c *Client) ListServices(ctx context.Context, cluster string, progress func(n int)) (*ServiceList, error) {
+	services := &ServiceList{}
+	var describeErr error
+	err := c.ECS.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: &cluster},
+		func(page *ecs.ListServicesOutput, lastPage bool) bool {
+			if len(page.ServiceArns) == 0 {
+				return true
+			}
+			result, err := c.ECS.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+				Cluster:  &cluster,
+				Services: page.ServiceArns,
+				Include:  []*string{aws.String(ecs.ServiceFieldTags)},
+			})
+			if err != nil {
+				describeErr = err
+				return false
+			}
+			services.Failures = append(services.Failures, result.Failures...)
+			services.Services = append(services.Services, result.Services...)
+			if progress != nil {
+				progress(len(services.Services))
+			}
+			return true
+		})
+	if describeErr != nil {
+		return services, describeErr
+	}
+	return services, err
+}
+
+// ListTaskArns lists the tasks with the given desired status. If service is empty, tasks for the
+// whole cluster are listed. The service name is used as given, it is not expanded. On error, the
+// tasks listed so far are returned with it.
+func (c *Client) ListTaskArns(ctx context.Context, cluster, service, status string) ([]*string, error) {
+	tasks := []*string{}
+	input := &ecs.ListTasksInput{
+		Cluster:       &cluster,
+		DesiredStatus: aws.String(status),
+	}
+	if service != "" {
+		input.ServiceName = &service
+	}
+	err := c.ECS.ListTasksPagesWithContext(ctx, input, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		tasks = append(tasks, page.TaskArns...)
+		return true
+	})
+	return tasks, err
+}
+
+// DescribeTasks describes the given tasks with their tags, batching requests to stay within the
+// DescribeTasks limit. On error, the tasks described so far are returned with it.
+func (c *Client) DescribeTasks(ctx context.Context, cluster string, taskArns []*string) (*TaskList, error) {
+	const batchSize = 100
+	tasks := &TaskList{}
+	for start := 0; start < len(taskArns); start += batchSize {
+		end := start + batchSize
+		if end > len(taskArns) {
+			end = len(taskArns)
+		}
+		result, err := c.ECS.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: &cluster,
+			Tasks:   taskArns[start:end],
+			Include: []*string{aws.String(ecs.TaskFieldTags)},
+		})
+		if err != nil {
+			return tasks, err
+		}
+		tasks.Failures = append(tasks.Failures, result.Failures...)
+		tasks.Tasks = append(tasks.Tasks, result.Tasks...)
+	}
+	return tasks, nil
+}
+
+// ResolveTask returns the given task ID or ARN, or if a service name is given instead, the ARN of
+// an arbitrary running task of that service. If the service has no running tasks, the error wraps
+// ErrNoTasks.
+func (c *Client) ResolveTask(ctx context.Context, cluster, taskOrService string) (string, error) {
+	if IsTaskARN(taskOrService) || IsTaskID(taskOrService) {
+		return taskOrService, nil
+	}
+	service, err := c.ServiceName(cluster, taskOrService)
+	if err != nil {
+		return "", err
+	}
+	taskArns, err := c.ListTaskArns(ctx, cluster, service, ecs.DesiredStatusRunning)
+	if err != nil {
+		return "", fmt.Errorf("could not list tasks: %w", err)
+	}
+	if len(taskArns) == 0 {
+		return "", fmt.Errorf("service %v: %w", service, ErrNoTasks)
+	}
+	return *taskArns[0], nil
+}
+
+// ListContainerInstances describes every container instance registered to the cluster. On error,
+// the container instances described so far are returned with it.
+func (c *Client) ListContainerInstances(ctx context.Context, cluster string) ([]*ecs.ContainerInstance, error) {
+	instances := []*ecs.ContainerInstance{}
+	var describeErr error
+	err := c.ECS.ListContainerInstancesPagesWithContext(ctx, &ecs.ListContainerInstancesInput{Cluster: &cluster},
+		func(page *ecs.ListContainerInstancesOutput, lastPage bool) bool {
+			if len(page.ContainerInstanceArns) == 0 {
+				return true
+			}
+			result, err := c.ECS.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+				Cluster:            &cluster,
+				ContainerInstances: page.ContainerInstanceArns,
+			})
+			if err != nil {
+				describeErr = err
+				return false
+			}
+			instances = append(instances, result.ContainerInstances...)
+			return true
+		})
+	if describeErr != nil {
+		return instances, describeErr
+	}
+	return instances, err
+}
+
+// DescribeContainerInstances describes the given container instances, each once, batching requests
+// to stay within the DescribeContainerInstances limit. On error, the container instances described
+// so far are returned with it.
+func (c *Client) DescribeContainerInstances(ctx context.Context, cluster string, containerInstanceArns []string) ([]*ecs.ContainerInstance, error) {
+	const batchSize = 100
+	seen := map[string]bool{}
+	arns := []*string{}
+	for _, arn := range containerInstanceArns {
+		if !seen[arn] {
+			seen[arn] = true
+			arns = append(arns, aws.String(arn))
+		}
+	}
+	instances := []*ecs.ContainerInstance{}
+	for start := 0; start < len(arns); start += batchSize {
+		end := start + batchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		result, err := c.ECS.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            &cluster,
+			ContainerInstances: arns[start:end],
+		})
+		if err != nil {
+			return instances, err
+		}
+		instances = append(instances, result.ContainerInstances...)
+	}
+	return instances, nil
+}
+
+// DescribeTaskDefinitions describes each distinct task definition once and returns them keyed by
+// ARN.
+func (c *Client) DescribeTaskDefinitions(ctx context.Context, taskDefinitionArns []string) (map[string]*ecs.TaskDefinition, error) {
+	taskDefinitions := map[string]*ecs.TaskDefinition{}
+	for _, arn := range taskDefinitionArns {
+		if _, ok := taskDefinitions[arn]; ok {
+			continue
+		}
+		result, err := c.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(arn),
+		})
+		if err != nil {
+			return nil, err
+		}
+		taskDefinitions[arn] = result.TaskDefinition
+	}
+	return taskDefinitions, nil
+}
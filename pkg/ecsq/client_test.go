@@ -0,0 +1,127 @@
+package ecsq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+)
+
+// fakeECS serves a fixed set of tasks for a single service.
+type fakeECS struct {
+	ecsiface.ECSAPI
+	service       string
+	tasks         map[string]*ecs.Task
+	calls         int
+	instanceCalls int
+}
+
+func (f *fakeECS) DescribeTasksWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	f.calls++
+	if len(in.Tasks) > 100 {
+		return nil, fmt.Errorf("too many tasks: %v", len(in.Tasks))
+	}
+	out := &ecs.DescribeTasksOutput{}
+	for _, arn := range in.Tasks {
+		if task, ok := f.tasks[*arn]; ok {
+			out.Tasks = append(out.Tasks, task)
+		} else {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: arn, Reason: aws.String("MISSING")})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeECS) DescribeContainerInstancesWithContext(ctx aws.Context, in *ecs.DescribeContainerInstancesInput, opts ...request.Option) (*ecs.DescribeContainerInstancesOutput, error) {
+	f.instanceCalls++
+	if len(in.ContainerInstances) > 100 {
+		return nil, fmt.Errorf("too many container instances: %v", len(in.ContainerInstances))
+	}
+	out := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range in.ContainerInstances {
+		out.ContainerInstances = append(out.ContainerInstances, &ecs.ContainerInstance{ContainerInstanceArn: arn})
+	}
+	return out, nil
+}
+
+func (f *fakeECS) ListTasksPagesWithContext(ctx aws.Context, in *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool, opts ...request.Option) error {
+	page := &ecs.ListTasksOutput{}
+	if aws.StringValue(in.ServiceName) == f.service {
+		for arn := range f.tasks {
+			page.TaskArns = append(page.TaskArns, aws.String(arn))
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	api := &fakeECS{service: "service-applepicker-ecs-prod", tasks: map[string]*ecs.Task{}}
+	arns := []*string{}
+	for i := 0; i < 250; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:task/ecs-prod/%032x", i)
+		api.tasks[arn] = &ecs.Task{TaskArn: aws.String(arn)}
+		arns = append(arns, aws.String(arn))
+	}
+	client := New(api)
+	client.ServiceNameExpansion = "service-{{.Name}}-{{.Cluster}}"
+	ctx := context.Background()
+
+	tasks, err := client.DescribeTasks(ctx, "ecs-prod", arns)
+	if err != nil || len(tasks.Tasks) != 250 || api.calls != 3 {
+		t.Errorf("DescribeTasks returned %v tasks in %v calls, err %v", len(tasks.Tasks), api.calls, err)
+	}
+
+	instanceArns := []string{}
+	for i := 0; i < 150; i++ {
+		// Many tasks run on each instance, so the same instance is asked for more than once.
+		instanceArns = append(instanceArns, fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:container-instance/ecs-prod/%032x", i%120))
+	}
+	instances, err := client.DescribeContainerInstances(ctx, "ecs-prod", instanceArns)
+	if err != nil || len(instances) != 120 || api.instanceCalls != 2 {
+		t.Errorf("DescribeContainerInstances returned %v instances in %v calls, err %v", len(instances), api.instanceCalls, err)
+	}
+
+	_, err = client.DescribeTask(ctx, "ecs-prod", "0b4b2b4daf475ee0bf19157238902649")
+	var failure *FailureError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &failure) || failure.Arn != "0b4b2b4daf475ee0bf19157238902649" {
+		t.Errorf("expected a not found failure, got %v", err)
+	}
+
+	arn, err := client.ResolveTask(ctx, "ecs-prod", "applepicker")
+	if err != nil || api.tasks[arn] == nil {
+		t.Errorf("ResolveTask returned %q, %v", arn, err)
+	}
+	if _, err := client.ResolveTask(ctx, "ecs-prod", "bananapicker"); !errors.Is(err, ErrNoTasks) {
+		t.Errorf("expected ErrNoTasks, got %v", err)
+	}
+}
+
+// emptyECS returns neither resources nor failures from Describe calls.
+type emptyECS struct {
+	ecsiface.ECSAPI
+}
+
+func (emptyECS) DescribeTasksWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	return &ecs.DescribeTasksOutput{}, nil
+}
+
+func (emptyECS) DescribeServicesWithContext(ctx aws.Context, in *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{}, nil
+}
+
+func TestClientEmptyResults(t *testing.T) {
+	client := New(emptyECS{})
+	ctx := context.Background()
+	if _, err := client.DescribeTask(ctx, "ecs-prod", "0b4b2b4daf475ee0bf19157238902649"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from DescribeTask, got %v", err)
+	}
+	if _, err := client.DescribeService(ctx, "ecs-prod", "applepicker"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from DescribeService, got %v", err)
+	}
+}
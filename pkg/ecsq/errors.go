@@ -0,0 +1,54 @@
+package ecsq
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+var (
+	// ErrNotFound is returned when the task or service asked for does not exist. It is wrapped by a
+	// *FailureError, so check for it with errors.Is.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNoTasks is returned when a task of a service is asked for, but the service has no running
+	// tasks.
+	ErrNoTasks = errors.New("no running tasks")
+
+	// ErrInvalidServiceNameExpansion is returned when the service name expansion is not a valid
+	// template.
+	ErrInvalidServiceNameExpansion = errors.New("invalid service name expansion template")
+)
+
+// FailureError is a failure ECS reported for a single resource of a Describe call.
+type FailureError struct {
+	Arn    string
+	Reason string
+	Detail string
+}
+
+// NewFailureError returns the error for a failure from a Describe call.
+func NewFailureError(f *ecs.Failure) *FailureError {
+	return &FailureError{
+		Arn:    aws.StringValue(f.Arn),
+		Reason: aws.StringValue(f.Reason),
+		Detail: aws.StringValue(f.Detail),
+	}
+}
+
+func (e *FailureError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%v: %v (%v)", e.Arn, e.Reason, e.Detail)
+	}
+	return fmt.Sprintf("%v: %v", e.Arn, e.Reason)
+}
+
+// Unwrap returns ErrNotFound for MISSING failures.
+func (e *FailureError) Unwrap() error {
+	if e.Reason == "MISSING" {
+		return ErrNotFound
+	}
+	return nil
+}
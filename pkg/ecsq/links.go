@@ -0,0 +1,39 @@
+package ecsq
+
+import "fmt"
+
+// ServiceLink returns the URL to the ECS service on the AWS console
+func ServiceLink(region, cluster, service string) string {
+	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/services/%v/tasks"
+	return fmt.Sprintf(tmpl, region, region, cluster, service)
+}
+
+// ClusterLink returns the URL to the ECS cluster on the AWS console
+func ClusterLink(region, cluster string) string {
+	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/services"
+	return fmt.Sprintf(tmpl, region, region, cluster)
+}
+
+// TaskLink returns the URL to the ECS task on the AWS console
+func TaskLink(region, cluster, taskID string) string {
+	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/tasks/%v"
+	return fmt.Sprintf(tmpl, region, region, cluster, taskID)
+}
+
+// TaskDefinitionLink returns the URL to the ECS task definition on the AWS console.
+func TaskDefinitionLink(region string, taskDefinition *ARN) string {
+	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/taskDefinitions/%v/%v"
+	return fmt.Sprintf(tmpl, region, region, taskDefinition.Name, taskDefinition.Instance)
+}
+
+// ContainerInstanceLink returns the URL to the ECS container instance on the AWS console.
+func ContainerInstanceLink(region, cluster, containerInstance string) string {
+	tmpl := "https://%v.console.aws.amazon.com/ecs/home?region=%v#/clusters/%v/containerInstances/%v"
+	return fmt.Sprintf(tmpl, region, region, cluster, containerInstance)
+}
+
+// EC2InstanceLink returns the URL to the EC2 instance on the AWS console.
+func EC2InstanceLink(region, ec2Instance string) string {
+	tmpl := "https://%v.console.aws.amazon.com/ec2/v2/home?region=%v#Instances:instanceId=%v"
+	return fmt.Sprintf(tmpl, region, region, ec2Instance)
+}
@@ -0,0 +1,80 @@
+package ecsq
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ServiceNameExpansionEnv is the environment variable the ecsq CLI reads the service name
+// expansion from.
+const ServiceNameExpansionEnv = "ECSQ_SERVICE_NAME_EXPANSION"
+
+// ExpandServiceName expands a short service name into the full service name using expansion, a
+// text/template with the fields .Name and .Cluster. Names that are already expanded, and every
+// name if expansion is empty, are returned unchanged. An invalid template returns an error
+// wrapping ErrInvalidServiceNameExpansion.
+func ExpandServiceName(expansion, cluster, service string) (string, error) {
+	if expansion == "" {
+		return service, nil
+	}
+	// First detect if service name has already been expanded.
+	interpolateRegex := regexp.MustCompile("{{.*}}")
+	alreadyExpandedRegex, err := regexp.Compile(interpolateRegex.ReplaceAllString(expansion, ".*"))
+	if err == nil && alreadyExpandedRegex.MatchString(service) {
+		return service, nil
+	}
+	tmpl, err := template.New("serviceName").Parse(expansion)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidServiceNameExpansion, err)
+	}
+	buffer := bytes.NewBuffer(nil)
+	err = tmpl.Execute(buffer, struct {
+		Name    string
+		Cluster string
+	}{
+		Name:    service,
+		Cluster: cluster,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidServiceNameExpansion, err)
+	}
+	return buffer.String(), nil
+}
+
+// ShortServiceName reverses ExpandServiceName, returning the short name of a full service name. If
+// expansion is empty or the name does not match it, the name is returned unchanged.
+func ShortServiceName(expansion, cluster, service string) string {
+	if expansion == "" {
+		return service
+	}
+	actionRegex := regexp.MustCompile("{{.*?}}")
+	pattern := "^"
+	last := 0
+	for _, loc := range actionRegex.FindAllStringIndex(expansion, -1) {
+		pattern += regexp.QuoteMeta(expansion[last:loc[0]])
+		action := expansion[loc[0]:loc[1]]
+		switch {
+		case strings.Contains(action, ".Name"):
+			pattern += "(?P<name>.+)"
+		case strings.Contains(action, ".Cluster"):
+			pattern += regexp.QuoteMeta(cluster)
+		default:
+			pattern += ".*"
+		}
+		last = loc[1]
+	}
+	pattern += regexp.QuoteMeta(expansion[last:]) + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return service
+	}
+	match := re.FindStringSubmatch(service)
+	i := re.SubexpIndex("name")
+	if match == nil || i < 0 {
+		return service
+	}
+	return match[i]
+}
@@ -0,0 +1,31 @@
+package ecsq
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServiceNames(t *testing.T) {
+	const expansion = "service-{{.Name}}-{{.Cluster}}"
+	for _, tc := range []struct{ service, full string }{
+		{"applepicker", "service-applepicker-ecs-prod"},
+		{"service-applepicker-ecs-prod", "service-applepicker-ecs-prod"},
+	} {
+		full, err := ExpandServiceName(expansion, "ecs-prod", tc.service)
+		if err != nil || full != tc.full {
+			t.Errorf("ExpandServiceName(%q) = %q, %v, want %q", tc.service, full, err, tc.full)
+		}
+	}
+	if short := ShortServiceName(expansion, "ecs-prod", "service-applepicker-ecs-prod"); short != "applepicker" {
+		t.Errorf("ShortServiceName = %q, want applepicker", short)
+	}
+	if short := ShortServiceName(expansion, "ecs-prod", "service-applepicker-ecs-staging"); short != "service-applepicker-ecs-staging" {
+		t.Errorf("ShortServiceName of another cluster's service = %q", short)
+	}
+	if name, err := ExpandServiceName("", "ecs-prod", "applepicker"); err != nil || name != "applepicker" {
+		t.Errorf("ExpandServiceName without an expansion = %q, %v", name, err)
+	}
+	if _, err := ExpandServiceName("{{.Name", "ecs-prod", "applepicker"); !errors.Is(err, ErrInvalidServiceNameExpansion) {
+		t.Errorf("expected ErrInvalidServiceNameExpansion, got %v", err)
+	}
+}
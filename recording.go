@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecorded is returned in replay mode when a request has no recorded response.
+var ErrNotRecorded = errors.New("no recorded response, record the command again")
+
+// Interaction is an AWS API request and its response, as stored in a recording. Credentials are not
+// stored, and values that look like secrets are replaced with <redacted>.
+type Interaction struct {
+	Service   string           `json:"service"`
+	Operation string           `json:"operation"`
+	Region    string           `json:"region"`
+	Request   RecordedRequest  `json:"request"`
+	Response  RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request that identifies the call.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Target string `json:"target,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response to replay.
+type RecordedResponse struct {
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType"`
+	RequestID   string `json:"requestId,omitempty"`
+	// Body is the JSON of JSON responses, and a string for others.
+	Body json.RawMessage `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that writes every AWS API call made through it to a directory,
+// one file per call. Requests that are not AWS API calls, such as those for instance credentials,
+// are passed through without being recorded.
+type Recorder struct {
+	Dir  string
+	Next http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecorder returns a recorder that writes to dir. If dir already holds a recording, new calls are
+// added after it.
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	names, err := recordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{Dir: dir, Next: next}
+	if len(names) > 0 {
+		r.seq, _ = strconv.Atoi(strings.SplitN(names[len(names)-1], "-", 2)[0])
+	}
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	call := identifyAPICall(req, body)
+	resp, err := r.Next.RoundTrip(req)
+	if err != nil || call.Operation == "" {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	interaction := &Interaction{
+		Service:   call.Service,
+		Operation: call.Operation,
+		Region:    call.Region,
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Target: req.Header.Get("X-Amz-Target"),
+			Body:   string(ScrubBody(req.Header.Get("Content-Type"), body)),
+		},
+		Response: RecordedResponse{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			RequestID:   resp.Header.Get("X-Amzn-Requestid"),
+			Body:        recordedBody(ScrubBody(resp.Header.Get("Content-Type"), respBody)),
+		},
+	}
+	if err := r.write(interaction); err != nil {
+		return nil, fmt.Errorf("could not record %v %v: %w", call.Service, call.Operation, err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) write(interaction *Interaction) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(interaction); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	name := fmt.Sprintf("%04d-%v.%v.json", r.seq, interaction.Service, interaction.Operation)
+	return os.WriteFile(filepath.Join(r.Dir, name), buf.Bytes(), 0o600)
+}
+
+func recordedBody(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	b, _ := json.Marshal(string(body))
+	return b
+}
+
+// recordingFiles returns the names of the recorded calls in dir, in the order they were made.
+func recordingFiles(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "[0-9][0-9][0-9][0-9]*-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, match := range matches {
+		names = append(names, filepath.Base(match))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Replayer is an http.RoundTripper that serves responses from a recording, without making
+// requests. A request is answered with the next unused response to the same call with the same
+// parameters, or failing that, to the same operation, so calls with timestamps in them, such as
+// metrics queries, still replay. Once all matching responses are used, the last one is repeated.
+type Replayer struct {
+	mu    sync.Mutex
+	byKey map[string]*replayQueue
+	byOp  map[string]*replayQueue
+}
+
+type replayQueue struct {
+	interactions []*Interaction
+	next         int
+}
+
+func (q *replayQueue) pop() *Interaction {
+	i := q.interactions[q.next]
+	if q.next < len(q.interactions)-1 {
+		q.next++
+	}
+	return i
+}
+
+// NewReplayer loads the recording in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	names, err := recordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no recording in %v", dir)
+	}
+	r := &Replayer{byKey: map[string]*replayQueue{}, byOp: map[string]*replayQueue{}}
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		interaction := &Interaction{}
+		if err := json.Unmarshal(b, interaction); err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+		r.add(r.byKey, replayKey(interaction.Region, interaction.Request.Target, interaction.Operation, []byte(interaction.Request.Body)), interaction)
+		r.add(r.byOp, replayKey(interaction.Region, interaction.Request.Target, interaction.Operation, nil), interaction)
+	}
+	return r, nil
+}
+
+func (r *Replayer) add(queues map[string]*replayQueue, key string, interaction *Interaction) {
+	q, ok := queues[key]
+	if !ok {
+		q = &replayQueue{}
+		queues[key] = q
+	}
+	q.interactions = append(q.interactions, interaction)
+}
+
+func replayKey(region, target, operation string, body []byte) string {
+	return region + "\n" + target + "\n" + operation + "\n" + string(body)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	call := identifyAPICall(req, body)
+	target := req.Header.Get("X-Amz-Target")
+	scrubbed := ScrubBody(req.Header.Get("Content-Type"), body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, ok := r.byKey[replayKey(call.Region, target, call.Operation, scrubbed)]
+	if !ok {
+		q, ok = r.byOp[replayKey(call.Region, target, call.Operation, nil)]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%v %v in %v: %w", call.Service, call.Operation, call.Region, ErrNotRecorded)
+	}
+	return q.pop().Response.response(req), nil
+}
+
+func (r *RecordedResponse) response(req *http.Request) *http.Response {
+	var body []byte
+	var s string
+	if err := json.Unmarshal(r.Body, &s); err == nil {
+		body = []byte(s)
+	} else {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, r.Body); err == nil {
+			body = buf.Bytes()
+		} else {
+			body = r.Body
+		}
+	}
+	header := http.Header{}
+	header.Set("Content-Type", r.ContentType)
+	if r.RequestID != "" {
+		header.Set("X-Amzn-Requestid", r.RequestID)
+	}
+	return &http.Response{
+		Status:        http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// ScrubBody replaces values that look like secrets in a JSON, XML or form encoded request or
+// response body with <redacted>, the same way --debug does for parameters. The result is
+// deterministic, so scrubbed requests can still be matched against a recording.
+func ScrubBody(contentType string, body []byte) []byte {
+	switch {
+	case len(body) == 0:
+		return body
+	case strings.Contains(contentType, "json") || json.Valid(body):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return body
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(redact(v))
+		return bytes.TrimSpace(buf.Bytes())
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		for key, vs := range values {
+			for i, v := range vs {
+				if SecretReason(key, v) != "" {
+					vs[i] = redactedValue
+				}
+			}
+		}
+		return []byte(values.Encode())
+	case strings.Contains(contentType, "xml"):
+		return xmlElementPattern.ReplaceAllFunc(body, func(element []byte) []byte {
+			m := xmlElementPattern.FindSubmatch(element)
+			if string(m[1]) != string(m[3]) || SecretReason(string(m[1]), string(m[2])) == "" {
+				return element
+			}
+			return []byte("<" + string(m[1]) + ">" + html.EscapeString(redactedValue) + "</" + string(m[1]) + ">")
+		})
+	}
+	return body
+}
+
+// xmlElementPattern matches elements with text content. Go's regexp has no backreferences, so the
+// closing tag is checked separately.
+var xmlElementPattern = regexp.MustCompile(`<([A-Za-z][\w.-]*)>([^<]*)</([A-Za-z][\w.-]*)>`)
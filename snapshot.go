@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// SnapshotSchemaVersion is the version of the snapshot file format written by this version of ecsq.
+// It must be incremented whenever a change to the format would break reading older snapshots.
+const SnapshotSchemaVersion = 1
+
+// Snapshot is a point-in-time capture of a cluster, suitable for writing to a file.
+type Snapshot struct {
+	SchemaVersion   int                       `json:"schemaVersion"`
+	CapturedAt      time.Time                 `json:"capturedAt"`
+	Region          string                    `json:"region"`
+	Cluster         ClusterSnapshot           `json:"cluster"`
+	Services        []*ServiceSnapshot        `json:"services"`
+	TaskDefinitions []*TaskDefinitionSnapshot `json:"taskDefinitions"`
+	Tasks           []*TaskSummary            `json:"tasks"`
+}
+
+// ClusterSnapshot holds the summary counts of a cluster.
+type ClusterSnapshot struct {
+	Name               string `json:"name"`
+	Arn                string `json:"arn"`
+	Status             string `json:"status"`
+	ContainerInstances int64  `json:"containerInstances"`
+	ActiveServices     int64  `json:"activeServices"`
+	RunningTasks       int64  `json:"runningTasks"`
+	PendingTasks       int64  `json:"pendingTasks"`
+}
+
+// ServiceSnapshot holds the state of a service and its deployments.
+type ServiceSnapshot struct {
+	Name                    string                `json:"name"`
+	Arn                     string                `json:"arn"`
+	Status                  string                `json:"status"`
+	LaunchType              string                `json:"launchType,omitempty"`
+	TaskDefinition          string                `json:"taskDefinition"`
+	DesiredCount            int64                 `json:"desiredCount"`
+	RunningCount            int64                 `json:"runningCount"`
+	PendingCount            int64                 `json:"pendingCount"`
+	DeploymentConfiguration string                `json:"deploymentConfiguration,omitempty"`
+	LoadBalancerPorts       []string              `json:"loadBalancerPorts,omitempty"`
+	Deployments             []*DeploymentSnapshot `json:"deployments"`
+	CreatedAt               *time.Time            `json:"createdAt,omitempty"`
+}
+
+// DeploymentSnapshot holds the state of a single service deployment.
+type DeploymentSnapshot struct {
+	ID             string     `json:"id"`
+	Status         string     `json:"status"`
+	RolloutState   string     `json:"rolloutState,omitempty"`
+	TaskDefinition string     `json:"taskDefinition"`
+	DesiredCount   int64      `json:"desiredCount"`
+	RunningCount   int64      `json:"runningCount"`
+	PendingCount   int64      `json:"pendingCount"`
+	FailedTasks    int64      `json:"failedTasks"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
+
+// TaskDefinitionSnapshot holds the parts of a task definition revision that matter for auditing.
+type TaskDefinitionSnapshot struct {
+	Arn        string               `json:"arn"`
+	Family     string               `json:"family"`
+	Revision   int64                `json:"revision"`
+	CPU        string               `json:"cpu,omitempty"`
+	Memory     string               `json:"memory,omitempty"`
+	Containers []*ContainerSnapshot `json:"containers"`
+}
+
+// ContainerSnapshot holds a container definition within a task definition.
+type ContainerSnapshot struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	CPU    int64  `json:"cpu"`
+	Memory int64  `json:"memory"`
+}
+
+// TaskSummary is a short summary of a running task.
+type TaskSummary struct {
+	ID             string     `json:"id"`
+	Group          string     `json:"group"`
+	TaskDefinition string     `json:"taskDefinition"`
+	LastStatus     string     `json:"lastStatus"`
+	HealthStatus   string     `json:"healthStatus,omitempty"`
+	LaunchType     string     `json:"launchType,omitempty"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+}
+
+// SnapshotChange is a single difference between two snapshots.
+type SnapshotChange struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+}
+
+// TakeSnapshot captures the cluster, its services, their task definitions and running tasks.
+func TakeSnapshot(ctx context.Context, svc *ecs.ECS, region, clusterName string) (*Snapshot, error) {
+	clusters, err := svc.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{Clusters: []*string{&clusterName}})
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters.Clusters) == 0 {
+		return nil, fmt.Errorf("cluster %v not found", clusterName)
+	}
+	cluster := clusters.Clusters[0]
+	snapshot := &Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		CapturedAt:    time.Now().UTC(),
+		Region:        region,
+		Cluster: ClusterSnapshot{
+			Name:               aws.StringValue(cluster.ClusterName),
+			Arn:                aws.StringValue(cluster.ClusterArn),
+			Status:             aws.StringValue(cluster.Status),
+			ContainerInstances: aws.Int64Value(cluster.RegisteredContainerInstancesCount),
+			ActiveServices:     aws.Int64Value(cluster.ActiveServicesCount),
+			RunningTasks:       aws.Int64Value(cluster.RunningTasksCount),
+			PendingTasks:       aws.Int64Value(cluster.PendingTasksCount),
+		},
+	}
+
+	services, err := listServices(ctx, svc, clusterName, nil)
+	if err != nil {
+		return nil, err
+	}
+	MustParseSort("name", ServiceSortKeys).Sort(services.Services)
+	taskDefinitionArns := []string{}
+	for _, service := range services.Services {
+		snapshot.Services = append(snapshot.Services, newServiceSnapshot(service))
+		taskDefinitionArns = append(taskDefinitionArns, aws.StringValue(service.TaskDefinition))
+		for _, deployment := range service.Deployments {
+			taskDefinitionArns = append(taskDefinitionArns, aws.StringValue(deployment.TaskDefinition))
+		}
+	}
+	taskDefinitions, err := getTaskDefinitions(ctx, svc, taskDefinitionArns)
+	if err != nil {
+		return nil, err
+	}
+	for _, taskDefinition := range taskDefinitions {
+		snapshot.TaskDefinitions = append(snapshot.TaskDefinitions, newTaskDefinitionSnapshot(taskDefinition))
+	}
+	sort.Slice(snapshot.TaskDefinitions, func(i, j int) bool {
+		return snapshot.TaskDefinitions[i].Arn < snapshot.TaskDefinitions[j].Arn
+	})
+
+	taskArns, err := getTasksArns(ctx, svc, clusterName, "", ecs.DesiredStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := describeTasks(ctx, svc, clusterName, taskArns)
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks.Tasks {
+		snapshot.Tasks = append(snapshot.Tasks, &TaskSummary{
+			ID:             ecsq.ParseARN(aws.StringValue(task.TaskArn)).Name,
+			Group:          aws.StringValue(task.Group),
+			TaskDefinition: aws.StringValue(task.TaskDefinitionArn),
+			LastStatus:     aws.StringValue(task.LastStatus),
+			HealthStatus:   aws.StringValue(task.HealthStatus),
+			LaunchType:     aws.StringValue(task.LaunchType),
+			StartedAt:      task.StartedAt,
+		})
+	}
+	sort.Slice(snapshot.Tasks, func(i, j int) bool {
+		a, b := snapshot.Tasks[i], snapshot.Tasks[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.ID < b.ID
+	})
+	return snapshot, nil
+}
+
+func newServiceSnapshot(service *ecs.Service) *ServiceSnapshot {
+	config := NewServiceConfig("", service, nil)
+	s := &ServiceSnapshot{
+		Name:                    aws.StringValue(service.ServiceName),
+		Arn:                     aws.StringValue(service.ServiceArn),
+		Status:                  aws.StringValue(service.Status),
+		LaunchType:              aws.StringValue(service.LaunchType),
+		TaskDefinition:          aws.StringValue(service.TaskDefinition),
+		DesiredCount:            aws.Int64Value(service.DesiredCount),
+		RunningCount:            aws.Int64Value(service.RunningCount),
+		PendingCount:            aws.Int64Value(service.PendingCount),
+		DeploymentConfiguration: config.DeploymentConfiguration,
+		LoadBalancerPorts:       config.LoadBalancerPorts,
+		CreatedAt:               service.CreatedAt,
+	}
+	for _, d := range service.Deployments {
+		s.Deployments = append(s.Deployments, &DeploymentSnapshot{
+			ID:             aws.StringValue(d.Id),
+			Status:         aws.StringValue(d.Status),
+			RolloutState:   aws.StringValue(d.RolloutState),
+			TaskDefinition: aws.StringValue(d.TaskDefinition),
+			DesiredCount:   aws.Int64Value(d.DesiredCount),
+			RunningCount:   aws.Int64Value(d.RunningCount),
+			PendingCount:   aws.Int64Value(d.PendingCount),
+			FailedTasks:    aws.Int64Value(d.FailedTasks),
+			CreatedAt:      d.CreatedAt,
+			UpdatedAt:      d.UpdatedAt,
+		})
+	}
+	return s
+}
+
+func newTaskDefinitionSnapshot(taskDefinition *ecs.TaskDefinition) *TaskDefinitionSnapshot {
+	s := &TaskDefinitionSnapshot{
+		Arn:      aws.StringValue(taskDefinition.TaskDefinitionArn),
+		Family:   aws.StringValue(taskDefinition.Family),
+		Revision: aws.Int64Value(taskDefinition.Revision),
+		CPU:      aws.StringValue(taskDefinition.Cpu),
+		Memory:   aws.StringValue(taskDefinition.Memory),
+	}
+	for _, c := range taskDefinition.ContainerDefinitions {
+		s.Containers = append(s.Containers, &ContainerSnapshot{
+			Name:   aws.StringValue(c.Name),
+			Image:  aws.StringValue(c.Image),
+			CPU:    aws.Int64Value(c.Cpu),
+			Memory: aws.Int64Value(c.Memory),
+		})
+	}
+	return s
+}
+
+// WriteSnapshot writes the snapshot as indented JSON.
+func WriteSnapshot(w io.Writer, snapshot *Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snapshot)
+}
+
+// ReadSnapshotFile reads a snapshot file, rejecting schema versions this version of ecsq does not
+// understand.
+func ReadSnapshotFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snapshot := &Snapshot{}
+	if err := json.NewDecoder(f).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("could not parse snapshot %v: %v", path, err)
+	}
+	if snapshot.SchemaVersion < 1 || snapshot.SchemaVersion > SnapshotSchemaVersion {
+		return nil, fmt.Errorf("snapshot %v has unsupported schema version %v", path, snapshot.SchemaVersion)
+	}
+	return snapshot, nil
+}
+
+// DiffSnapshots returns the changes between two snapshots of the same cluster: added and removed
+// services, scaling, new task definition revisions, image changes and running task counts.
+func DiffSnapshots(before, after *Snapshot) []SnapshotChange {
+	changes := []SnapshotChange{}
+	add := func(kind, subject, b, a string) {
+		if b != a {
+			changes = append(changes, SnapshotChange{Kind: kind, Subject: subject, Before: b, After: a})
+		}
+	}
+	add("Cluster", "Container Instances", fmt.Sprint(before.Cluster.ContainerInstances), fmt.Sprint(after.Cluster.ContainerInstances))
+	add("Cluster", "Running Tasks", fmt.Sprint(before.Cluster.RunningTasks), fmt.Sprint(after.Cluster.RunningTasks))
+
+	beforeServices := map[string]*ServiceSnapshot{}
+	for _, s := range before.Services {
+		beforeServices[s.Name] = s
+	}
+	afterServices := map[string]*ServiceSnapshot{}
+	for _, s := range after.Services {
+		afterServices[s.Name] = s
+	}
+	beforeTaskDefinitions := before.taskDefinitionsByArn()
+	afterTaskDefinitions := after.taskDefinitionsByArn()
+	beforeTasks := before.runningTaskCounts()
+	afterTasks := after.runningTaskCounts()
+
+	for _, s := range before.Services {
+		if _, ok := afterServices[s.Name]; !ok {
+			add("Removed Service", s.Name, s.Status, "")
+		}
+	}
+	for _, a := range after.Services {
+		b, ok := beforeServices[a.Name]
+		if !ok {
+			add("New Service", a.Name, "", a.Status)
+			continue
+		}
+		add("Status", a.Name, b.Status, a.Status)
+		add("Scaling", a.Name, fmt.Sprint(b.DesiredCount), fmt.Sprint(a.DesiredCount))
+		add("Running Tasks", a.Name, fmt.Sprint(beforeTasks["service:"+b.Name]), fmt.Sprint(afterTasks["service:"+a.Name]))
+		add("Task Definition", a.Name, taskDefinitionRevision(b.TaskDefinition), taskDefinitionRevision(a.TaskDefinition))
+		add("Deployment Configuration", a.Name, b.DeploymentConfiguration, a.DeploymentConfiguration)
+		add("Deployments", a.Name, fmt.Sprint(len(b.Deployments)), fmt.Sprint(len(a.Deployments)))
+		bImages := beforeTaskDefinitions[b.TaskDefinition].images()
+		aImages := afterTaskDefinitions[a.TaskDefinition].images()
+		for _, container := range unionKeys(bImages, aImages) {
+			add("Image", a.Name+" ("+container+")", bImages[container], aImages[container])
+		}
+	}
+	return changes
+}
+
+func (s *Snapshot) taskDefinitionsByArn() map[string]*TaskDefinitionSnapshot {
+	m := map[string]*TaskDefinitionSnapshot{}
+	for _, td := range s.TaskDefinitions {
+		m[td.Arn] = td
+	}
+	return m
+}
+
+func (s *Snapshot) runningTaskCounts() map[string]int {
+	counts := map[string]int{}
+	for _, task := range s.Tasks {
+		counts[task.Group]++
+	}
+	return counts
+}
+
+func (td *TaskDefinitionSnapshot) images() map[string]string {
+	images := map[string]string{}
+	if td == nil {
+		return images
+	}
+	for _, c := range td.Containers {
+		images[c.Name] = c.Image
+	}
+	return images
+}
+
+func unionKeys(maps ...map[string]string) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// taskDefinitionRevision shortens a task definition ARN to family:revision.
+func taskDefinitionRevision(arn string) string {
+	if !strings.HasPrefix(arn, "arn:") {
+		return arn
+	}
+	parsed := ecsq.ParseARN(arn)
+	if parsed.Instance == "" {
+		return parsed.Name
+	}
+	return parsed.Name + ":" + parsed.Instance
+}
+
+// RenderSnapshotChanges writes the changes in the given format, either table or json.
+func RenderSnapshotChanges(w io.Writer, before, after *Snapshot, changes []SnapshotChange, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	fmt.Fprintf(w, "Changes in %v between %v and %v\n", after.Cluster.Name,
+		before.CapturedAt.Format(time.RFC3339), after.CapturedAt.Format(time.RFC3339))
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return nil
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Change", "Subject", "Before", "After"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, c := range changes {
+		table.Append([]string{c.Kind, c.Subject, c.Before, c.After})
+	}
+	table.Render()
+	return nil
+}
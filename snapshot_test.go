@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := &Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Services: []*ServiceSnapshot{
+			{Name: "web", Status: "ACTIVE", DesiredCount: 2, TaskDefinition: "arn:aws:ecs:us-west-2:1111:task-definition/web:3"},
+			{Name: "old", Status: "ACTIVE", DesiredCount: 1},
+		},
+		TaskDefinitions: []*TaskDefinitionSnapshot{
+			{Arn: "arn:aws:ecs:us-west-2:1111:task-definition/web:3", Containers: []*ContainerSnapshot{{Name: "web", Image: "web:v1"}}},
+		},
+		Tasks: []*TaskSummary{{ID: "a", Group: "service:web"}, {ID: "b", Group: "service:web"}},
+	}
+	after := &Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Services: []*ServiceSnapshot{
+			{Name: "web", Status: "ACTIVE", DesiredCount: 4, TaskDefinition: "arn:aws:ecs:us-west-2:1111:task-definition/web:4"},
+			{Name: "new", Status: "ACTIVE", DesiredCount: 1},
+		},
+		TaskDefinitions: []*TaskDefinitionSnapshot{
+			{Arn: "arn:aws:ecs:us-west-2:1111:task-definition/web:4", Containers: []*ContainerSnapshot{{Name: "web", Image: "web:v2"}}},
+		},
+		Tasks: []*TaskSummary{{ID: "a", Group: "service:web"}, {ID: "b", Group: "service:web"}},
+	}
+	expected := []SnapshotChange{
+		{Kind: "Removed Service", Subject: "old", Before: "ACTIVE", After: ""},
+		{Kind: "Scaling", Subject: "web", Before: "2", After: "4"},
+		{Kind: "Task Definition", Subject: "web", Before: "web:3", After: "web:4"},
+		{Kind: "Image", Subject: "web (web)", Before: "web:v1", After: "web:v2"},
+		{Kind: "New Service", Subject: "new", Before: "", After: "ACTIVE"},
+	}
+	if got := DiffSnapshots(before, after); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestReadSnapshotFileRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	buf := &bytes.Buffer{}
+	if err := WriteSnapshot(buf, &Snapshot{SchemaVersion: SnapshotSchemaVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSnapshotFile(path); err == nil {
+		t.Errorf("Expected an error reading a snapshot with a newer schema")
+	}
+}
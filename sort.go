@@ -1,87 +1,202 @@
 package main
 
 import (
+	"fmt"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
 )
 
-// ClusterSlice attaches the Sort interface to ecs.Cluster
-type ClusterSlice []*ecs.Cluster
-
-func (s ClusterSlice) Len() int {
-	return len([]*ecs.Cluster(s))
-}
-
-func (s ClusterSlice) Less(i, j int) bool {
-	return string(*s[i].ClusterName) < string(*s[j].ClusterName)
-}
-
-func (s ClusterSlice) Swap(i, j int) {
-	s[j], s[i] = s[i], s[j]
-}
-
-// Sort is a convenience method for sorting clusters
-func (s ClusterSlice) Sort() {
-	sort.Sort(s)
-}
-
-// ServiceSlice attaches the Sort interface to ecs.Service
-type ServiceSlice []*ecs.Service
-
-func (s ServiceSlice) Len() int {
-	return len([]*ecs.Service(s))
-}
-
-func (s ServiceSlice) Less(i, j int) bool {
-	return string(*s[i].ServiceName) < string(*s[j].ServiceName)
-}
-
-func (s ServiceSlice) Swap(i, j int) {
-	s[j], s[i] = s[i], s[j]
-}
-
-// Sort is a convenience method for sorting clusters
-func (s ServiceSlice) Sort() {
-	sort.Sort(s)
-}
-
-// ServiceEventSlice attaches the Sort interface to ecs.ServiceEvent
-type ServiceEventSlice []*ecs.ServiceEvent
-
-func (s ServiceEventSlice) Len() int {
-	return len([]*ecs.ServiceEvent(s))
-}
-
-func (s ServiceEventSlice) Less(i, j int) bool {
-	return s[i].CreatedAt.Before(*s[j].CreatedAt)
-}
-
-func (s ServiceEventSlice) Swap(i, j int) {
-	s[j], s[i] = s[i], s[j]
-}
-
-// Sort is a convenience method for sorting clusters
-func (s ServiceEventSlice) Sort() {
-	sort.Sort(s)
-}
-
-// KeyValuePairSlice attaches the Sort interface to ecs.KeyValuePair
-type KeyValuePairSlice []*ecs.KeyValuePair
-
-func (s KeyValuePairSlice) Len() int {
-	return len([]*ecs.KeyValuePair(s))
-}
-
-func (s KeyValuePairSlice) Less(i, j int) bool {
-	return *s[i].Name < *s[j].Name
-}
-
-func (s KeyValuePairSlice) Swap(i, j int) {
-	s[j], s[i] = s[i], s[j]
-}
-
-// Sort is a convenience method for sorting clusters
-func (s KeyValuePairSlice) Sort() {
-	sort.Sort(s)
+// SortKey is a named field that rows of type T can be sorted by.
+type SortKey[T any] struct {
+	Name string
+	// Compare returns a negative number if a sorts before b, a positive number if a sorts after b,
+	// and zero if they are equal.
+	Compare func(a, b T) int
+}
+
+// StringKey returns a key that sorts lexically by the value.
+func StringKey[T any](name string, value func(T) string) SortKey[T] {
+	return SortKey[T]{Name: name, Compare: func(a, b T) int {
+		return strings.Compare(value(a), value(b))
+	}}
+}
+
+// NumberKey returns a key that sorts numerically by the value.
+func NumberKey[T any](name string, value func(T) int64) SortKey[T] {
+	return SortKey[T]{Name: name, Compare: func(a, b T) int {
+		va, vb := value(a), value(b)
+		switch {
+		case va < vb:
+			return -1
+		case va > vb:
+			return 1
+		}
+		return 0
+	}}
+}
+
+// FloatKey returns a key that sorts numerically by a fractional value.
+func FloatKey[T any](name string, value func(T) float64) SortKey[T] {
+	return SortKey[T]{Name: name, Compare: func(a, b T) int {
+		va, vb := value(a), value(b)
+		switch {
+		case va < vb:
+			return -1
+		case va > vb:
+			return 1
+		}
+		return 0
+	}}
+}
+
+// TimeKey returns a key that sorts chronologically by the value. Nil times sort first.
+func TimeKey[T any](name string, value func(T) *time.Time) SortKey[T] {
+	return SortKey[T]{Name: name, Compare: func(a, b T) int {
+		va, vb := aws.TimeValue(value(a)), aws.TimeValue(value(b))
+		switch {
+		case va.Before(vb):
+			return -1
+		case va.After(vb):
+			return 1
+		}
+		return 0
+	}}
+}
+
+type sortTerm[T any] struct {
+	key        SortKey[T]
+	descending bool
+}
+
+// Sorter sorts rows by a list of keys, each ascending or descending.
+type Sorter[T any] []sortTerm[T]
+
+// ParseSort parses a comma-separated list of key names, each optionally prefixed with - to sort
+// descending, e.g. "-running,name".
+func ParseSort[T any](spec string, keys []SortKey[T]) (Sorter[T], error) {
+	sorter := Sorter[T]{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		descending := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "-"), "+")
+		key, ok := findSortKey(keys, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q, valid keys are %v", name, strings.Join(SortKeyNames(keys), ", "))
+		}
+		sorter = append(sorter, sortTerm[T]{key: key, descending: descending})
+	}
+	return sorter, nil
+}
+
+// MustParseSort is like ParseSort but panics on an invalid spec. It is used for default orders.
+func MustParseSort[T any](spec string, keys []SortKey[T]) Sorter[T] {
+	sorter, err := ParseSort(spec, keys)
+	if err != nil {
+		panic(err)
+	}
+	return sorter
+}
+
+// Sort sorts the rows in place. Rows that compare equal on every key keep their relative order.
+func (s Sorter[T]) Sort(rows []T) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, term := range s {
+			c := term.key.Compare(rows[i], rows[j])
+			if term.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// SortKeyNames returns the names of the keys, for help and error messages.
+func SortKeyNames[T any](keys []SortKey[T]) []string {
+	names := []string{}
+	for _, key := range keys {
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+func findSortKey[T any](keys []SortKey[T], name string) (SortKey[T], bool) {
+	for _, key := range keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return SortKey[T]{}, false
+}
+
+// ClusterSortKeys are the keys clusters can be sorted by.
+var ClusterSortKeys = []SortKey[*ecs.Cluster]{
+	StringKey("name", func(c *ecs.Cluster) string { return aws.StringValue(c.ClusterName) }),
+	StringKey("status", func(c *ecs.Cluster) string { return aws.StringValue(c.Status) }),
+	NumberKey("instances", func(c *ecs.Cluster) int64 { return aws.Int64Value(c.RegisteredContainerInstancesCount) }),
+	NumberKey("services", func(c *ecs.Cluster) int64 { return aws.Int64Value(c.ActiveServicesCount) }),
+	NumberKey("running", func(c *ecs.Cluster) int64 { return aws.Int64Value(c.RunningTasksCount) }),
+	NumberKey("pending", func(c *ecs.Cluster) int64 { return aws.Int64Value(c.PendingTasksCount) }),
+}
+
+// ServiceSortKeys are the keys services can be sorted by.
+var ServiceSortKeys = []SortKey[*ecs.Service]{
+	StringKey("name", func(s *ecs.Service) string { return aws.StringValue(s.ServiceName) }),
+	StringKey("status", func(s *ecs.Service) string { return aws.StringValue(s.Status) }),
+	StringKey("launch-type", func(s *ecs.Service) string { return aws.StringValue(s.LaunchType) }),
+	StringKey("task-definition", func(s *ecs.Service) string { return aws.StringValue(s.TaskDefinition) }),
+	NumberKey("desired", func(s *ecs.Service) int64 { return aws.Int64Value(s.DesiredCount) }),
+	NumberKey("running", func(s *ecs.Service) int64 { return aws.Int64Value(s.RunningCount) }),
+	NumberKey("pending", func(s *ecs.Service) int64 { return aws.Int64Value(s.PendingCount) }),
+	NumberKey("deployments", func(s *ecs.Service) int64 { return int64(len(s.Deployments)) }),
+	TimeKey("deployed", func(s *ecs.Service) *time.Time {
+		if d := PrimaryDeployment(s); d != nil {
+			return d.CreatedAt
+		}
+		return nil
+	}),
+	TimeKey("created", func(s *ecs.Service) *time.Time { return s.CreatedAt }),
+}
+
+// TaskSortKeys are the keys tasks can be sorted by.
+var TaskSortKeys = []SortKey[*ecs.Task]{
+	StringKey("arn", func(t *ecs.Task) string { return aws.StringValue(t.TaskArn) }),
+	StringKey("status", func(t *ecs.Task) string { return aws.StringValue(t.LastStatus) }),
+	StringKey("health", func(t *ecs.Task) string { return aws.StringValue(t.HealthStatus) }),
+	StringKey("task-definition", func(t *ecs.Task) string { return aws.StringValue(t.TaskDefinitionArn) }),
+	StringKey("group", func(t *ecs.Task) string { return aws.StringValue(t.Group) }),
+	TimeKey("created", func(t *ecs.Task) *time.Time { return t.CreatedAt }),
+	TimeKey("started", func(t *ecs.Task) *time.Time { return t.StartedAt }),
+	TimeKey("stopped", func(t *ecs.Task) *time.Time { return t.StoppedAt }),
+}
+
+// ServiceEventSortKeys are the keys service events can be sorted by.
+var ServiceEventSortKeys = []SortKey[*ecs.ServiceEvent]{
+	TimeKey("time", func(e *ecs.ServiceEvent) *time.Time { return e.CreatedAt }),
+	StringKey("message", func(e *ecs.ServiceEvent) string { return aws.StringValue(e.Message) }),
+}
+
+// KeyValuePairSortKeys are the keys environment variables can be sorted by.
+var KeyValuePairSortKeys = []SortKey[*ecs.KeyValuePair]{
+	StringKey("name", func(p *ecs.KeyValuePair) string { return aws.StringValue(p.Name) }),
+	StringKey("value", func(p *ecs.KeyValuePair) string { return aws.StringValue(p.Value) }),
+}
+
+// PrimaryDeployment returns the service's PRIMARY deployment, or nil if it has none.
+func PrimaryDeployment(s *ecs.Service) *ecs.Deployment {
+	for _, d := range s.Deployments {
+		if aws.StringValue(d.Status) == "PRIMARY" {
+			return d
+		}
+	}
+	return nil
 }
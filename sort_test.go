@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func serviceNames(services []*ecs.Service) []string {
+	names := []string{}
+	for _, s := range services {
+		names = append(names, *s.ServiceName)
+	}
+	return names
+}
+
+func TestSortServices(t *testing.T) {
+	now := time.Now()
+	services := []*ecs.Service{
+		{ServiceName: aws.String("b"), RunningCount: aws.Int64(2), Deployments: []*ecs.Deployment{{Status: aws.String("PRIMARY"), CreatedAt: aws.Time(now)}}},
+		{ServiceName: aws.String("c"), RunningCount: aws.Int64(10)},
+		{ServiceName: aws.String("a"), RunningCount: aws.Int64(2), Deployments: []*ecs.Deployment{{Status: aws.String("PRIMARY"), CreatedAt: aws.Time(now.Add(-time.Hour))}}},
+	}
+	cases := map[string][]string{
+		"name":          {"a", "b", "c"},
+		"-name":         {"c", "b", "a"},
+		"-running,name": {"c", "a", "b"},
+		// Numeric, not lexical: 10 sorts after 2.
+		"running,-name": {"b", "a", "c"},
+		"deployed":      {"c", "a", "b"},
+	}
+	for spec, expected := range cases {
+		sorter, err := ParseSort(spec, ServiceSortKeys)
+		if err != nil {
+			t.Fatalf("%v: %v", spec, err)
+		}
+		sorter.Sort(services)
+		if got := serviceNames(services); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%v: expected %v, got %v", spec, expected, got)
+		}
+	}
+	if _, err := ParseSort("bogus", ServiceSortKeys); err == nil {
+		t.Errorf("Expected an error for an unknown key")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Column is a named column in a table of rows of type T.
+type Column[T any] struct {
+	// Name is used to select the column with --columns.
+	Name   string
+	Header string
+	// Wide columns are only shown with -o wide, unless selected with --columns.
+	Wide  bool
+	Value func(T) string
+}
+
+// ColumnNames returns the names of the columns, for help and error messages.
+func ColumnNames[T any](columns []Column[T]) []string {
+	names := []string{}
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// SelectColumns picks the named columns in the given order. If no names are given, it picks the
+// default columns, plus the wide ones if wide is set.
+func SelectColumns[T any](columns []Column[T], names []string, wide bool) ([]Column[T], error) {
+	if len(names) == 0 {
+		selected := []Column[T]{}
+		for _, c := range columns {
+			if wide || !c.Wide {
+				selected = append(selected, c)
+			}
+		}
+		return selected, nil
+	}
+	selected := []Column[T]{}
+	for _, name := range names {
+		found := false
+		for _, c := range columns {
+			if c.Name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q, valid columns are %v", name, strings.Join(ColumnNames(columns), ", "))
+		}
+	}
+	return selected, nil
+}
+
+// SplitList splits a comma-separated flag value, dropping empty items.
+func SplitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// RenderTable writes the rows as a table with the given columns, fitted to the terminal width.
+func RenderTable[T any](w io.Writer, columns []Column[T], rows []T) {
+	header := []string{}
+	for _, c := range columns {
+		header = append(header, c.Header)
+	}
+	cells := [][]string{}
+	for _, row := range rows {
+		line := []string{}
+		for _, c := range columns {
+			line = append(line, c.Value(row))
+		}
+		cells = append(cells, line)
+	}
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.AppendBulk(FitRows(header, cells, TerminalWidth()))
+	table.Render()
+}
+
+// NewTable returns a table writer that leaves wrapping to FitRows.
+func NewTable(w io.Writer) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	return table
+}
+
+const minColumnWidth = 8
+
+// FitRows wraps cell values so that a bordered table of the rows fits within width characters.
+// The widest columns are narrowed first. A width of zero or less means there is no limit.
+func FitRows(header []string, rows [][]string, width int) [][]string {
+	if width <= 0 || len(rows) == 0 {
+		return rows
+	}
+	widths := make([]int, len(rows[0]))
+	for i := range widths {
+		if i < len(header) {
+			widths[i] = runewidth.StringWidth(header[i])
+		}
+		for _, row := range rows {
+			if i < len(row) && runewidth.StringWidth(row[i]) > widths[i] {
+				widths[i] = runewidth.StringWidth(row[i])
+			}
+		}
+	}
+	// Each column is padded by a space on both sides and followed by a border.
+	total := 1
+	for _, w := range widths {
+		total += w + 3
+	}
+	limits := append([]int{}, widths...)
+	for total > width {
+		widest := 0
+		for i := range limits {
+			if limits[i] > limits[widest] {
+				widest = i
+			}
+		}
+		narrowed := limits[widest] - (total - width)
+		if narrowed < minColumnWidth {
+			narrowed = minColumnWidth
+		}
+		if narrowed >= limits[widest] {
+			break
+		}
+		total -= limits[widest] - narrowed
+		limits[widest] = narrowed
+	}
+	fitted := make([][]string, len(rows))
+	for r, row := range rows {
+		fitted[r] = make([]string, len(row))
+		for i, cell := range row {
+			if i < len(limits) && limits[i] < widths[i] {
+				cell = WrapText(cell, limits[i])
+			}
+			fitted[r][i] = cell
+		}
+	}
+	return fitted
+}
+
+// WrapText breaks s into lines of at most width characters, preferring to break at spaces and
+// splitting long words such as URLs.
+func WrapText(s string, width int) string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for runewidth.StringWidth(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				head := runewidth.Truncate(word, width, "")
+				lines = append(lines, head)
+				word = word[len(head):]
+			}
+			switch {
+			case line == "":
+				line = word
+			case runewidth.StringWidth(line)+1+runewidth.StringWidth(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TerminalWidth returns the width of the terminal stdout is attached to, or 0 if stdout is not a
+// terminal. The COLUMNS environment variable takes precedence.
+func TerminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return terminalWidth(os.Stdout)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestSelectColumns(t *testing.T) {
+	all := ServiceColumns("us-west-2", "ecs-prod")
+	columns, err := SelectColumns(all, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ColumnNames(columns); !reflect.DeepEqual(got, []string{"name", "status", "desired", "running", "pending"}) {
+		t.Errorf("Unexpected default columns %v", got)
+	}
+	columns, _ = SelectColumns(all, nil, true)
+	if len(columns) != len(all) {
+		t.Errorf("Expected all %v columns in wide mode, got %v", len(all), len(columns))
+	}
+	columns, err = SelectColumns(all, SplitList("running, name,link"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ColumnNames(columns); !reflect.DeepEqual(got, []string{"running", "name", "link"}) {
+		t.Errorf("Unexpected selected columns %v", got)
+	}
+	if got := columns[2].Value(&ecs.Service{ServiceName: aws.String("web")}); !strings.HasSuffix(got, "/clusters/ecs-prod/services/web/tasks") {
+		t.Errorf("Unexpected link %v", got)
+	}
+	if _, err := SelectColumns(all, []string{"bogus"}, false); err == nil {
+		t.Errorf("Expected an error for an unknown column")
+	}
+}
+
+func TestFitRows(t *testing.T) {
+	link := "https://us-west-2.console.aws.amazon.com/ecs/home?region=us-west-2#/clusters/ecs-prod/services/applepicker/tasks"
+	rows := [][]string{{"Service Link", link}}
+	if got := FitRows(nil, rows, 0); !reflect.DeepEqual(got, rows) {
+		t.Errorf("Expected rows to be unchanged without a width")
+	}
+	fitted := FitRows(nil, rows, 60)
+	if fitted[0][0] != "Service Link" {
+		t.Errorf("Expected the narrow column to be unchanged, got %q", fitted[0][0])
+	}
+	lines := strings.Split(fitted[0][1], "\n")
+	// 60 columns, less the first column, padding and borders.
+	for _, line := range lines {
+		if len(line) > 60-len("Service Link")-7 {
+			t.Errorf("Line %q is too long", line)
+		}
+	}
+	if strings.Join(lines, "") != link {
+		t.Errorf("Expected wrapped link to contain the whole link, got %q", fitted[0][1])
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	if got := WrapText("the quick brown fox", 10); got != "the quick\nbrown fox" {
+		t.Errorf("Unexpected wrap %q", got)
+	}
+	if got := WrapText("abcdefghijkl mn", 5); got != "abcde\nfghij\nkl mn" {
+		t.Errorf("Unexpected wrap %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Tag selector operators
+const (
+	TagEquals    = "="
+	TagNotEquals = "!="
+	TagExists    = "exists"
+	TagNotExists = "!exists"
+)
+
+// TagSelector matches resources by one of their tags.
+type TagSelector struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+var tagSelectorPattern = regexp.MustCompile(`^(!?)([^=!]+)(?:(!?=)(.*))?$`)
+
+// ParseTagSelector parses a selector of the form key=value, key!=value, key (the tag exists) or
+// !key (the tag does not exist).
+func ParseTagSelector(s string) (TagSelector, error) {
+	m := tagSelectorPattern.FindStringSubmatch(s)
+	if m == nil {
+		return TagSelector{}, fmt.Errorf("invalid tag selector %q", s)
+	}
+	negate, key, op, value := m[1] == "!", m[2], m[3], m[4]
+	switch {
+	case negate && op != "":
+		return TagSelector{}, fmt.Errorf("invalid tag selector %q, use key!=value", s)
+	case negate:
+		return TagSelector{Key: key, Op: TagNotExists}, nil
+	case op == "":
+		return TagSelector{Key: key, Op: TagExists}, nil
+	}
+	return TagSelector{Key: key, Op: op, Value: value}, nil
+}
+
+// ParseTagSelectors parses each selector with ParseTagSelector.
+func ParseTagSelectors(selectors []string) ([]TagSelector, error) {
+	parsed := []TagSelector{}
+	for _, s := range selectors {
+		selector, err := ParseTagSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, selector)
+	}
+	return parsed, nil
+}
+
+// Matches returns whether the tags satisfy the selector. A key!=value selector matches resources
+// that do not have the tag at all.
+func (s TagSelector) Matches(tags []*ecs.Tag) bool {
+	value, ok := lookupTag(tags, s.Key)
+	switch s.Op {
+	case TagEquals:
+		return ok && value == s.Value
+	case TagNotEquals:
+		return !ok || value != s.Value
+	case TagExists:
+		return ok
+	case TagNotExists:
+		return !ok
+	}
+	return false
+}
+
+// MatchTags returns whether the tags satisfy every selector.
+func MatchTags(selectors []TagSelector, tags []*ecs.Tag) bool {
+	for _, s := range selectors {
+		if !s.Matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// TagValues returns the values of the given tag keys, with empty strings for missing tags.
+func TagValues(tags []*ecs.Tag, keys []string) []string {
+	values := []string{}
+	for _, key := range keys {
+		value, _ := lookupTag(tags, key)
+		values = append(values, value)
+	}
+	return values
+}
+
+func lookupTag(tags []*ecs.Tag, key string) (string, bool) {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value), true
+		}
+	}
+	return "", false
+}
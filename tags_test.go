@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestParseTagSelector(t *testing.T) {
+	cases := map[string]TagSelector{
+		"team=payments":  {Key: "team", Op: TagEquals, Value: "payments"},
+		"tier!=critical": {Key: "tier", Op: TagNotEquals, Value: "critical"},
+		"cost-center":    {Key: "cost-center", Op: TagExists},
+		"!cost-center":   {Key: "cost-center", Op: TagNotExists},
+		"url=http://a=b": {Key: "url", Op: TagEquals, Value: "http://a=b"},
+		"team=":          {Key: "team", Op: TagEquals, Value: ""},
+	}
+	for s, expected := range cases {
+		got, err := ParseTagSelector(s)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", s, err)
+		} else if got != expected {
+			t.Errorf("%v: expected %v, got %v", s, expected, got)
+		}
+	}
+	for _, s := range []string{"", "=value", "!team=payments"} {
+		if _, err := ParseTagSelector(s); err == nil {
+			t.Errorf("%v: expected an error", s)
+		}
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	tags := []*ecs.Tag{
+		{Key: aws.String("team"), Value: aws.String("payments")},
+		{Key: aws.String("tier"), Value: aws.String("1")},
+	}
+	selectors, err := ParseTagSelectors([]string{"team=payments", "tier!=2", "!cost-center", "tier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, MatchTags(selectors, tags))
+	selectors, _ = ParseTagSelectors([]string{"team=payments", "tier!=1"})
+	assertFalse(t, MatchTags(selectors, tags))
+	selectors, _ = ParseTagSelectors([]string{"team!=search"})
+	assertTrue(t, MatchTags(selectors, nil))
+}
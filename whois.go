@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/mightyguava/ecsq/pkg/ecsq"
+	"github.com/olekukonko/tablewriter"
+)
+
+// WhoisQuery is what to look up: an IP address with an optional port, or an EC2 instance ID.
+type WhoisQuery struct {
+	IP         string
+	Port       int64
+	InstanceID string
+}
+
+// ParseWhoisQuery parses ip, ip:port or i-xxxx.
+func ParseWhoisQuery(s string) (WhoisQuery, error) {
+	if strings.HasPrefix(s, "i-") {
+		return WhoisQuery{InstanceID: s}, nil
+	}
+	q := WhoisQuery{IP: s}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		q.IP = host
+		q.Port, err = strconv.ParseInt(port, 10, 64)
+		if err != nil || q.Port <= 0 {
+			return q, fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if net.ParseIP(q.IP) == nil {
+		return q, fmt.Errorf("%q is not an IP address, IP:port or EC2 instance ID", s)
+	}
+	return q, nil
+}
+
+func (q WhoisQuery) String() string {
+	switch {
+	case q.InstanceID != "":
+		return q.InstanceID
+	case q.Port != 0:
+		return net.JoinHostPort(q.IP, strconv.FormatInt(q.Port, 10))
+	}
+	return q.IP
+}
+
+// WhoisHost is a container instance and the EC2 instance behind it.
+type WhoisHost struct {
+	ContainerInstanceArn string
+	InstanceID           string
+	PrivateIP            string
+}
+
+// WhoisMatch is a task, container or container instance that matches a query.
+type WhoisMatch struct {
+	// Task is nil when only the container instance matched.
+	Task *ecs.Task
+	// Container is the matching container, or "" if the match is for the whole task.
+	Container string
+	// Address is the IP and port the match was found at.
+	Address string
+	// Via says how the match was found: task ENI, host port or container instance.
+	Via  string
+	Host *WhoisHost
+}
+
+// FindWhois searches the tasks' ENI attachments and network bindings, and the container
+// instances, for the query. hosts maps container instance ARNs to their hosts.
+func FindWhois(q WhoisQuery, tasks []*ecs.Task, hosts map[string]*WhoisHost) []WhoisMatch {
+	matches := []WhoisMatch{}
+	for _, host := range sortedHosts(hosts) {
+		if (q.InstanceID != "" && host.InstanceID == q.InstanceID) || (q.IP != "" && q.Port == 0 && host.PrivateIP == q.IP) {
+			matches = append(matches, WhoisMatch{Host: host, Address: host.PrivateIP, Via: "container instance"})
+		}
+	}
+	for _, task := range tasks {
+		host := hosts[aws.StringValue(task.ContainerInstanceArn)]
+		switch {
+		case q.InstanceID != "":
+			if host != nil && host.InstanceID == q.InstanceID {
+				matches = append(matches, WhoisMatch{Task: task, Host: host, Address: host.PrivateIP, Via: "container instance"})
+			}
+		case taskHasIP(task, q.IP):
+			matches = append(matches, matchPort(q, task, host, "task ENI", func(b *ecs.NetworkBinding) int64 {
+				if b.HostPort != nil {
+					return *b.HostPort
+				}
+				return aws.Int64Value(b.ContainerPort)
+			})...)
+		case host != nil && host.PrivateIP == q.IP && q.Port == 0:
+			matches = append(matches, WhoisMatch{Task: task, Host: host, Address: q.IP, Via: "container instance"})
+		case host != nil && host.PrivateIP == q.IP:
+			matches = append(matches, matchPort(q, task, host, "host port", func(b *ecs.NetworkBinding) int64 {
+				return aws.Int64Value(b.HostPort)
+			})...)
+		}
+	}
+	return matches
+}
+
+// matchPort matches the containers of a task at the query's port. Without a port the whole task
+// matches. The task's own IP always matches, so if none of its containers report network bindings
+// the whole task matches too.
+func matchPort(q WhoisQuery, task *ecs.Task, host *WhoisHost, via string, port func(*ecs.NetworkBinding) int64) []WhoisMatch {
+	if q.Port == 0 {
+		return []WhoisMatch{{Task: task, Host: host, Address: q.IP, Via: via}}
+	}
+	matches := []WhoisMatch{}
+	bindings := false
+	for _, c := range task.Containers {
+		for _, b := range c.NetworkBindings {
+			bindings = true
+			if port(b) == q.Port {
+				matches = append(matches, WhoisMatch{Task: task, Container: aws.StringValue(c.Name), Host: host, Address: q.String(), Via: via})
+			}
+		}
+	}
+	if !bindings && via == "task ENI" {
+		matches = append(matches, WhoisMatch{Task: task, Host: host, Address: q.String(), Via: via})
+	}
+	return matches
+}
+
+func taskHasIP(task *ecs.Task, ip string) bool {
+	if ip == "" {
+		return false
+	}
+	for _, a := range task.Attachments {
+		if aws.StringValue(a.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		for _, d := range a.Details {
+			if aws.StringValue(d.Name) == "privateIPv4Address" && aws.StringValue(d.Value) == ip {
+				return true
+			}
+		}
+	}
+	for _, c := range task.Containers {
+		for _, ni := range c.NetworkInterfaces {
+			if aws.StringValue(ni.PrivateIpv4Address) == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedHosts(hosts map[string]*WhoisHost) []*WhoisHost {
+	arns := []string{}
+	for arn := range hosts {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	sorted := []*WhoisHost{}
+	for _, arn := range arns {
+		sorted = append(sorted, hosts[arn])
+	}
+	return sorted
+}
+
+// GetWhoisCandidates collects the running tasks of the cluster, and its container instances with
+// the private IPs of their EC2 instances.
+func GetWhoisCandidates(ctx context.Context, svc *ecs.ECS, ec2svc *ec2.EC2, clusterName string) ([]*ecs.Task, map[string]*WhoisHost, error) {
+	arns, err := getTasksArns(ctx, svc, clusterName, "", ecs.DesiredStatusRunning)
+	if err != nil {
+		return nil, nil, err
+	}
+	tasks, err := describeTasks(ctx, svc, clusterName, arns)
+	if err != nil {
+		return nil, nil, err
+	}
+	instances, err := listContainerInstances(ctx, svc, clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts := map[string]*WhoisHost{}
+	byInstanceID := map[string]*WhoisHost{}
+	instanceIDs := []*string{}
+	for _, ci := range instances {
+		host := &WhoisHost{
+			ContainerInstanceArn: aws.StringValue(ci.ContainerInstanceArn),
+			InstanceID:           aws.StringValue(ci.Ec2InstanceId),
+		}
+		hosts[host.ContainerInstanceArn] = host
+		if host.InstanceID != "" {
+			byInstanceID[host.InstanceID] = host
+			instanceIDs = append(instanceIDs, ci.Ec2InstanceId)
+		}
+	}
+	if len(instanceIDs) > 0 {
+		err = ec2svc.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{InstanceIds: instanceIDs},
+			func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+				for _, r := range page.Reservations {
+					for _, i := range r.Instances {
+						if host, ok := byInstanceID[aws.StringValue(i.InstanceId)]; ok {
+							host.PrivateIP = aws.StringValue(i.PrivateIpAddress)
+						}
+					}
+				}
+				return true
+			})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return tasks.Tasks, hosts, nil
+}
+
+// RenderWhoisMatches writes the matches as a table, with links to the console.
+func RenderWhoisMatches(w io.Writer, region, cluster string, matches []WhoisMatch) {
+	header := []string{"Address", "Via", "Task", "Service", "Container", "Instance", "Link"}
+	rows := [][]string{}
+	for _, m := range matches {
+		instance, link := "", ""
+		if m.Host != nil {
+			instance = m.Host.InstanceID
+			link = ecsq.ContainerInstanceLink(region, cluster, ecsq.ParseARN(m.Host.ContainerInstanceArn).Name)
+		}
+		taskID, service := "", ""
+		if m.Task != nil {
+			taskID = ecsq.TaskID(aws.StringValue(m.Task.TaskArn))
+			service = strings.TrimPrefix(aws.StringValue(m.Task.Group), "service:")
+			link = ecsq.TaskLink(region, cluster, taskID)
+		}
+		rows = append(rows, []string{m.Address, m.Via, taskID, service, m.Container, instance, link})
+	}
+	table := NewTable(w)
+	table.SetHeader(header)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(FitRows(header, rows, TerminalWidth()))
+	table.Render()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestParseWhoisQuery(t *testing.T) {
+	q, err := ParseWhoisQuery("10.0.12.34:32768")
+	assertTrue(t, err == nil && q.IP == "10.0.12.34" && q.Port == 32768)
+	q, err = ParseWhoisQuery("10.0.12.34")
+	assertTrue(t, err == nil && q.IP == "10.0.12.34" && q.Port == 0)
+	q, err = ParseWhoisQuery("i-0a1b2c3d4e5f67890")
+	assertTrue(t, err == nil && q.InstanceID == "i-0a1b2c3d4e5f67890")
+	_, err = ParseWhoisQuery("10.0.12.34:http")
+	assertTrue(t, err != nil)
+	_, err = ParseWhoisQuery("applepicker")
+	assertTrue(t, err != nil)
+}
+
+func TestFindWhois(t *testing.T) {
+	hosts := map[string]*WhoisHost{
+		"ci-1": {ContainerInstanceArn: "ci-1", InstanceID: "i-1", PrivateIP: "10.0.1.10"},
+	}
+	bridge := &ecs.Task{
+		TaskArn:              aws.String("bridge"),
+		ContainerInstanceArn: aws.String("ci-1"),
+		Containers: []*ecs.Container{
+			{Name: aws.String("app"), NetworkBindings: []*ecs.NetworkBinding{{ContainerPort: aws.Int64(8000), HostPort: aws.Int64(32768)}}},
+			{Name: aws.String("sidecar"), NetworkBindings: []*ecs.NetworkBinding{{ContainerPort: aws.Int64(9000), HostPort: aws.Int64(32769)}}},
+		},
+	}
+	awsvpc := &ecs.Task{
+		TaskArn: aws.String("awsvpc"),
+		Attachments: []*ecs.Attachment{{
+			Type:    aws.String("ElasticNetworkInterface"),
+			Details: []*ecs.KeyValuePair{{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.2.20")}},
+		}},
+		Containers: []*ecs.Container{{Name: aws.String("app")}},
+	}
+	tasks := []*ecs.Task{bridge, awsvpc}
+
+	matches := FindWhois(WhoisQuery{IP: "10.0.1.10", Port: 32769}, tasks, hosts)
+	assertTrue(t, len(matches) == 1 && matches[0].Task == bridge && matches[0].Container == "sidecar" && matches[0].Via == "host port")
+
+	matches = FindWhois(WhoisQuery{IP: "10.0.1.10", Port: 1234}, tasks, hosts)
+	assertTrue(t, len(matches) == 0)
+
+	matches = FindWhois(WhoisQuery{IP: "10.0.2.20", Port: 8080}, tasks, hosts)
+	assertTrue(t, len(matches) == 1 && matches[0].Task == awsvpc && matches[0].Via == "task ENI")
+
+	matches = FindWhois(WhoisQuery{IP: "10.0.1.10"}, tasks, hosts)
+	assertTrue(t, len(matches) == 2 && matches[0].Task == nil && matches[1].Task == bridge)
+
+	matches = FindWhois(WhoisQuery{InstanceID: "i-1"}, tasks, hosts)
+	assertTrue(t, len(matches) == 2 && matches[0].Host.InstanceID == "i-1" && matches[1].Task == bridge)
+}